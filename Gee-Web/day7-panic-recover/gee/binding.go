@@ -0,0 +1,425 @@
+package gee
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content-Type MIME of the most common data formats
+const (
+	MIMEJSON              = "application/json"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+)
+
+// defaultMultipartMemory is the default of engine.MaxMultipartMemory
+const defaultMultipartMemory = 32 << 20 // 32 MB
+
+// ErrUnsupportedContentType is returned by Bind when the Content-Type of
+// the request has no binding
+var ErrUnsupportedContentType = errors.New("gee: unsupported content type")
+
+// BindingError reports the field that could not be bound
+type BindingError struct {
+	Source string // json, xml, form, query, uri or header
+	Field  string // the path of the struct field, e.g. "Address.City"
+	Value  string // the value that was rejected, if any
+	Err    error
+}
+
+func (e *BindingError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("gee: bind %s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("gee: bind %s field %s: %v", e.Source, e.Field, e.Err)
+}
+
+func (e *BindingError) Unwrap() error {
+	return e.Err
+}
+
+// Bind decodes the request into obj, the decoder is chosen from the
+// method and the Content-Type: JSON, XML, or the query and form values.
+// Every binding method then validates obj against its binding tags and
+// returns ValidationErrors when rules are broken.
+func (c *Context) Bind(obj interface{}) error {
+	if c.Method == http.MethodGet || c.Method == http.MethodHead {
+		return c.BindForm(obj)
+	}
+	switch c.ContentType() {
+	case MIMEJSON:
+		return c.BindJSON(obj)
+	case MIMEXML, MIMEXML2:
+		return c.BindXML(obj)
+	case MIMEPOSTForm, MIMEMultipartPOSTForm, "":
+		return c.BindForm(obj)
+	default:
+		return ErrUnsupportedContentType
+	}
+}
+
+// BindJSON decodes the JSON body into obj, using the json tags
+func (c *Context) BindJSON(obj interface{}) error {
+	if c.Req.Body == nil {
+		return &BindingError{Source: "json", Err: io.EOF}
+	}
+	if err := json.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &BindingError{Source: "json", Field: typeErr.Field, Value: typeErr.Value, Err: err}
+		}
+		return &BindingError{Source: "json", Err: err}
+	}
+	return validate(obj)
+}
+
+// BindXML decodes the XML body into obj, using the xml tags
+func (c *Context) BindXML(obj interface{}) error {
+	if c.Req.Body == nil {
+		return &BindingError{Source: "xml", Err: io.EOF}
+	}
+	if err := xml.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		return &BindingError{Source: "xml", Err: err}
+	}
+	return validate(obj)
+}
+
+// BindQuery binds the query string into obj, using the form tags
+func (c *Context) BindQuery(obj interface{}) error {
+	c.initQueryCache()
+	return bindValues(obj, formSource(c.queryCache), "form", "query")
+}
+
+// BindForm binds the query string and the urlencoded or multipart body
+// into obj, using the form tags
+func (c *Context) BindForm(obj interface{}) error {
+	if err := c.parseForm(); err != nil {
+		return &BindingError{Source: "form", Err: err}
+	}
+	return bindValues(obj, formSource(c.Req.Form), "form", "form")
+}
+
+// BindURI binds the parameters of the route into obj, using the uri tags
+func (c *Context) BindURI(obj interface{}) error {
+	return bindValues(obj, paramsSource(c.Params), "uri", "uri")
+}
+
+// BindHeader binds the request headers into obj, using the header tags
+func (c *Context) BindHeader(obj interface{}) error {
+	return bindValues(obj, headerSource(c.Req.Header), "header", "header")
+}
+
+// filterFlags strips the parameters of a header value,
+// "application/json; charset=utf-8" gives "application/json"
+func filterFlags(content string) string {
+	if i := strings.IndexAny(content, "; "); i >= 0 {
+		return content[:i]
+	}
+	return content
+}
+
+// bindSource gives the values of a key for the struct mapping
+type bindSource interface {
+	values(key string) ([]string, bool)
+}
+
+type formSource url.Values
+
+func (s formSource) values(key string) ([]string, bool) {
+	vs, ok := s[key]
+	return vs, ok
+}
+
+type headerSource http.Header
+
+func (s headerSource) values(key string) ([]string, bool) {
+	vs, ok := s[textproto.CanonicalMIMEHeaderKey(key)]
+	return vs, ok
+}
+
+type paramsSource Params
+
+func (s paramsSource) values(key string) ([]string, bool) {
+	if value, ok := Params(s).Get(key); ok {
+		return []string{value}, true
+	}
+	return nil, false
+}
+
+// bindValues maps src into the struct pointed to by obj. The key of a
+// field is its tag, or its name when untagged, "-" skips the field.
+// Nested structs are flattened, their fields use their own keys.
+func bindValues(obj interface{}, src bindSource, tag string, source string) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return &BindingError{Source: source, Err: errors.New("obj must be a non-nil pointer to a struct")}
+	}
+	if _, err := bindStruct(v.Elem(), src, tag, source, "", nil); err != nil {
+		return err
+	}
+	return validate(obj)
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// bindStruct reports whether any field of v was set. seen holds the
+// struct types being bound on the current path, a nested struct of one
+// of these types is skipped, so that recursive types terminate.
+func bindStruct(v reflect.Value, src bindSource, tag string, source string, path string, seen []reflect.Type) (bool, error) {
+	set := false
+	t := v.Type()
+	seen = append(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		key := field.Tag.Get(tag)
+		if key == "-" {
+			continue
+		}
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		if key == "" && isNestedStruct(field.Type) {
+			if containsType(seen, structType(field.Type)) {
+				continue
+			}
+			ok, err := bindNested(fv, src, tag, source, fieldPath, seen)
+			if err != nil {
+				return set, err
+			}
+			set = set || ok
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+
+		vs, ok := src.values(key)
+		if !ok || len(vs) == 0 {
+			continue
+		}
+		if err := setField(fv, field, vs); err != nil {
+			return set, &BindingError{Source: source, Field: fieldPath, Value: strings.Join(vs, ","), Err: err}
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// isNestedStruct reports whether t is a struct, or a pointer to one,
+// that is bound field by field rather than from a single value
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// structType returns t, or the type t points to
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func containsType(types []reflect.Type, t reflect.Type) bool {
+	for _, seen := range types {
+		if seen == t {
+			return true
+		}
+	}
+	return false
+}
+
+// bindNested binds a struct field, a nil pointer is only allocated when
+// one of its fields is present in src
+func bindNested(fv reflect.Value, src bindSource, tag string, source string, path string, seen []reflect.Type) (bool, error) {
+	if fv.Kind() != reflect.Ptr {
+		return bindStruct(fv, src, tag, source, path, seen)
+	}
+	if !fv.IsNil() {
+		return bindStruct(fv.Elem(), src, tag, source, path, seen)
+	}
+	if !hasKeys(fv.Type().Elem(), src, tag, seen) {
+		return false, nil
+	}
+	nv := reflect.New(fv.Type().Elem())
+	ok, err := bindStruct(nv.Elem(), src, tag, source, path, seen)
+	if ok && err == nil {
+		fv.Set(nv)
+	}
+	return ok, err
+}
+
+// hasKeys reports whether src has a value for a field of the struct
+// type t, nested structs included, with the keys of bindStruct
+func hasKeys(t reflect.Type, src bindSource, tag string, seen []reflect.Type) bool {
+	seen = append(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		key := field.Tag.Get(tag)
+		if key == "-" {
+			continue
+		}
+		if key == "" && isNestedStruct(field.Type) {
+			if nested := structType(field.Type); !containsType(seen, nested) && hasKeys(nested, src, tag, seen) {
+				return true
+			}
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		if vs, ok := src.values(key); ok && len(vs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// setField converts vs into the type of the field, slices get every value
+// and the other types the first one
+func setField(fv reflect.Value, field reflect.StructField, vs []string) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(vs), len(vs))
+		for i, s := range vs {
+			if err := setValue(slice.Index(i), field, s); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, field, vs[0])
+}
+
+func setValue(fv reflect.Value, field reflect.StructField, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		nv := reflect.New(fv.Type().Elem())
+		if err := setValue(nv.Elem(), field, s); err != nil {
+			return err
+		}
+		fv.Set(nv)
+		return nil
+	}
+
+	switch fv.Type() {
+	case timeType:
+		return setTime(fv, field, s)
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		// []byte
+		fv.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// setTime parses s with the time_format tag of the field, RFC 3339 by
+// default, "unix" and "unixnano" for timestamps. time_utc:"1" and
+// time_location:"Asia/Shanghai" set the location of layouts without zone.
+func setTime(fv reflect.Value, field reflect.StructField, s string) error {
+	layout := field.Tag.Get("time_format")
+	switch layout {
+	case "unix", "unixnano":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		t := time.Unix(n, 0)
+		if layout == "unixnano" {
+			t = time.Unix(0, n)
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case "":
+		layout = time.RFC3339
+	}
+
+	loc := time.Local
+	if utc, _ := strconv.ParseBool(field.Tag.Get("time_utc")); utc {
+		loc = time.UTC
+	}
+	if name := field.Tag.Get("time_location"); name != "" {
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return err
+		}
+		loc = l
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return err
+	}
+	fv.Set(reflect.ValueOf(t))
+	return nil
+}
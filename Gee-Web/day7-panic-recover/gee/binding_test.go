@@ -0,0 +1,161 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string `form:"city" json:"city"`
+	Zip  *int   `form:"zip" json:"zip"`
+}
+
+type bindUser struct {
+	Name     string        `form:"name" json:"name" xml:"name" uri:"name" header:"X-Name"`
+	Age      int           `form:"age" json:"age" xml:"age"`
+	Tags     []string      `form:"tag" json:"tags"`
+	Nickname *string       `form:"nickname" json:"nickname"`
+	Birthday time.Time     `form:"birthday" time_format:"2006-01-02" time_utc:"1"`
+	Seen     time.Time     `form:"seen" time_format:"unix"`
+	Timeout  time.Duration `form:"timeout"`
+	Address  bindAddress
+	Billing  *bindAddress `form:"-"`
+	Ignored  string       `form:"-"`
+}
+
+func newBindContext(method, target, contentType, body string) *Context {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c := New().allocateContext()
+	c.reset(httptest.NewRecorder(), req)
+	return c
+}
+
+func TestBindQuery(t *testing.T) {
+	c := newBindContext("GET", "/?name=gee&age=7&tag=a&tag=b&nickname=tutu&birthday=2020-01-02&seen=1600000000&timeout=1m&city=Hangzhou&zip=310000&Ignored=x", "", "")
+	var u bindUser
+	if err := c.BindQuery(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "gee" || u.Age != 7 || strings.Join(u.Tags, ",") != "a,b" || u.Nickname == nil || *u.Nickname != "tutu" {
+		t.Fatalf("unexpected binding %+v", u)
+	}
+	if !u.Birthday.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) || u.Seen.Unix() != 1600000000 || u.Timeout != time.Minute {
+		t.Fatalf("unexpected times %v %v %v", u.Birthday, u.Seen, u.Timeout)
+	}
+	if u.Address.City != "Hangzhou" || u.Address.Zip == nil || *u.Address.Zip != 310000 {
+		t.Fatalf("nested struct should be bound, got %+v", u.Address)
+	}
+	if u.Billing != nil || u.Ignored != "" {
+		t.Fatal("fields tagged - should be skipped")
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	c := newBindContext("GET", "/?age=seven", "", "")
+	var u bindUser
+	err := c.BindQuery(&u)
+	var bindErr *BindingError
+	if !errors.As(err, &bindErr) || bindErr.Field != "Age" || bindErr.Value != "seven" || bindErr.Source != "query" {
+		t.Fatalf("error should name the Age field, got %v", err)
+	}
+
+	c = newBindContext("GET", "/?zip=abc", "", "")
+	err = c.BindQuery(&u)
+	if !errors.As(err, &bindErr) || bindErr.Field != "Address.Zip" {
+		t.Fatalf("error should name the nested field, got %v", err)
+	}
+
+	c = newBindContext("POST", "/", MIMEJSON, `{"age":"seven"}`)
+	err = c.Bind(&u)
+	if !errors.As(err, &bindErr) || bindErr.Field != "age" || bindErr.Source != "json" {
+		t.Fatalf("json error should name the field, got %v", err)
+	}
+
+	c = newBindContext("POST", "/", "text/csv", "a,b")
+	if err := c.Bind(&u); err != ErrUnsupportedContentType {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestBindByContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{MIMEJSON + "; charset=utf-8", `{"name":"gee","age":7,"tags":["a","b"]}`},
+		{MIMEXML, `<bindUser><name>gee</name><age>7</age></bindUser>`},
+		{MIMEPOSTForm, "name=gee&age=7&tag=a&tag=b"},
+	}
+	for _, tt := range tests {
+		c := newBindContext("POST", "/", tt.contentType, tt.body)
+		var u bindUser
+		if err := c.Bind(&u); err != nil {
+			t.Fatalf("%s: %v", tt.contentType, err)
+		}
+		if u.Name != "gee" || u.Age != 7 {
+			t.Fatalf("%s: unexpected binding %+v", tt.contentType, u)
+		}
+	}
+}
+
+func TestBindURIAndHeader(t *testing.T) {
+	r := New()
+	r.GET("/users/:name", func(c *Context) {
+		var uri, header bindUser
+		if err := c.BindURI(&uri); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.BindHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		c.String(http.StatusOK, "%s %s", uri.Name, header.Name)
+	})
+	req := httptest.NewRequest("GET", "/users/geektutu", nil)
+	req.Header.Set("x-name", "gee")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "geektutu gee" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+type bindCategory struct {
+	Name   string `form:"name"`
+	Parent *bindCategory
+	Owner  *bindOwner
+}
+
+type bindOwner struct {
+	Email    string `form:"email"`
+	Category *bindCategory
+}
+
+func TestBindRecursiveStruct(t *testing.T) {
+	done := make(chan struct{})
+	var c bindCategory
+	var err error
+	go func() {
+		defer close(done)
+		err = newBindContext("GET", "/?name=a&email=gee@example.com", "", "").BindQuery(&c)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("binding a recursive struct did not terminate")
+	}
+	if err != nil || c.Name != "a" || c.Parent != nil || c.Owner == nil || c.Owner.Email != "gee@example.com" || c.Owner.Category != nil {
+		t.Fatalf("unexpected binding %+v, %v", c, err)
+	}
+
+	c = bindCategory{}
+	if err := newBindContext("GET", "/?name=a", "", "").BindQuery(&c); err != nil || c.Owner != nil {
+		t.Fatalf("a pointer without keys should stay nil, got %+v, %v", c, err)
+	}
+}
@@ -1,68 +1,415 @@
 package gee
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type H map[string]interface{}
 
+// Context implements context.Context on top of the request context.
+// It is recycled once the request is served, it must not be used
+// after the handler returns, e.g. from a goroutine started by the handler.
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
-	Req    *http.Request
-	// request info
-	Path   string
-	Method string
-	Params map[string]string
-	// response info
+	Writer    ResponseWriter
+	Req       *http.Request
+	writermem responseWriter
+	// StatusCode mirrors Writer.Status(), 200 until a status is set.
+	//
+	// Deprecated: use Writer.Status().
 	StatusCode int
+	// request info
+	Path     string
+	Method   string
+	Params   Params
+	fullPath string // the pattern of the matched route
+	// parsed once per request by the query and form accessors
+	queryCache url.Values
+	formCache  url.Values
 	// middleware
 	handlers []HandlerFunc
 	index    int
+	// errors attached by AbortWithError
+	Errors []error
+	// Keys is the key/value store of the request, see Set and Get
+	Keys map[string]interface{}
+	mu   sync.RWMutex // protects Keys
 	// engine pointer
 	engine *Engine
 }
 
-func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
-		Path:   req.URL.Path,
-		Method: req.Method,
-		Req:    req,
-		Writer: w,
-		index:  -1,
-	}
+// reset prepares a pooled Context for a new request. Params keeps its
+// capacity, so that steady-state requests do not allocate. handlers is
+// shared with the route, it is replaced and never appended to.
+func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	c.Req = req
+	c.Path = req.URL.Path
+	c.Method = req.Method
+	c.Params = c.Params[:0]
+	c.fullPath = ""
+	c.queryCache = nil
+	c.formCache = nil
+	c.handlers = nil
+	c.index = -1
+	c.Errors = nil
+	c.Keys = nil
 }
 
+// abortIndex is beyond any chain, so Next stops once index reaches it
+const abortIndex int = math.MaxInt / 2
+
 func (c *Context) Next() {
 	c.index++
-	s := len(c.handlers)
-	for ; c.index < s; c.index++ {
+	for c.index < len(c.handlers) {
 		c.handlers[c.index](c)
+		c.index++
 	}
 }
 
+// Abort prevents pending handlers from being called, the current handler
+// still runs to the end. Handlers that called Next before are resumed
+// when it returns, but none of the handlers after them.
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted returns true if the current context was aborted
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus calls Abort and writes the header with the status code
+func (c *Context) AbortWithStatus(code int) {
+	c.Abort()
+	c.Status(code)
+	c.Writer.WriteHeaderNow()
+}
+
+// AbortWithStatusJSON calls Abort and renders obj as the JSON body
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) {
+	c.Abort()
+	c.JSON(code, obj)
+}
+
+// AbortWithError calls AbortWithStatus and attaches err to c.Errors,
+// the body is left to the caller. It returns err.
+func (c *Context) AbortWithError(code int, err error) error {
+	c.Errors = append(c.Errors, err)
+	c.AbortWithStatus(code)
+	return err
+}
+
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{"message": err})
+	c.AbortWithStatusJSON(code, H{"message": err})
+}
+
+// Set stores a new key/value pair for this request, it lazily
+// initializes c.Keys and is safe for concurrent use
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// Get returns the value for the given key, and whether it exists
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.Keys[key]
+	return
+}
+
+// MustGet returns the value for the given key, it panics if the key
+// does not exist
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("gee: key \"" + key + "\" does not exist")
+}
+
+// Value returns the value for the given key if it exists and is a T
+func Value[T any](c *Context, key string) (T, bool) {
+	value, _ := c.Get(key)
+	t, ok := value.(T)
+	return t, ok
+}
+
+// GetString returns the value for the given key as a string
+func (c *Context) GetString(key string) string {
+	s, _ := Value[string](c, key)
+	return s
+}
+
+// GetBool returns the value for the given key as a bool
+func (c *Context) GetBool(key string) bool {
+	b, _ := Value[bool](c, key)
+	return b
+}
+
+// GetInt returns the value for the given key as an int
+func (c *Context) GetInt(key string) int {
+	i, _ := Value[int](c, key)
+	return i
+}
+
+// GetInt64 returns the value for the given key as an int64
+func (c *Context) GetInt64(key string) int64 {
+	i, _ := Value[int64](c, key)
+	return i
+}
+
+// GetFloat64 returns the value for the given key as a float64
+func (c *Context) GetFloat64(key string) float64 {
+	f, _ := Value[float64](c, key)
+	return f
+}
+
+// GetTime returns the value for the given key as a time.Time
+func (c *Context) GetTime(key string) time.Time {
+	t, _ := Value[time.Time](c, key)
+	return t
+}
+
+// GetDuration returns the value for the given key as a time.Duration
+func (c *Context) GetDuration(key string) time.Duration {
+	d, _ := Value[time.Duration](c, key)
+	return d
+}
+
+// GetStringSlice returns the value for the given key as a []string
+func (c *Context) GetStringSlice(key string) []string {
+	s, _ := Value[[]string](c, key)
+	return s
+}
+
+// Deadline returns the deadline of the request context
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+// Done returns the channel of the request context, it is closed when the
+// client goes away or a deadline set by WithTimeout expires
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+// Err returns the error of the request context
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value returns the value of c.Keys when key is a string stored by Set,
+// and the value of the request context otherwise
+func (c *Context) Value(key interface{}) interface{} {
+	if s, ok := key.(string); ok {
+		if value, exists := c.Get(s); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
+
+// WithTimeout replaces the request context by one that expires after d,
+// handlers later in the chain see the deadline through c and c.Req.
+// The returned cancel should be deferred by the caller.
+func (c *Context) WithTimeout(d time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithTimeout(c.Req.Context(), d)
+	c.Req = c.Req.WithContext(ctx)
+	return cancel
+}
+
+// WithValue replaces the request context by one carrying key/value,
+// handlers later in the chain see it through c and c.Req
+func (c *Context) WithValue(key, value interface{}) {
+	c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), key, value))
 }
 
 func (c *Context) Param(key string) string {
-	value, _ := c.Params[key]
+	return c.Params.ByName(key)
+}
+
+// initQueryCache parses the query string once per request
+func (c *Context) initQueryCache() {
+	if c.queryCache == nil {
+		c.queryCache = c.Req.URL.Query()
+	}
+}
+
+// initFormCache parses the urlencoded or multipart body once per
+// request, the cache holds the body values followed by the query values
+func (c *Context) initFormCache() {
+	if c.formCache == nil {
+		if err := c.parseForm(); err != nil {
+			c.Errors = append(c.Errors, err)
+		}
+		c.formCache = c.Req.Form
+		if c.formCache == nil {
+			c.formCache = url.Values{}
+		}
+	}
+}
+
+// Query returns the first value of the query key, or ""
+func (c *Context) Query(key string) string {
+	value, _ := c.GetQuery(key)
 	return value
 }
 
+// DefaultQuery returns the first value of the query key, or defaultValue
+// when the key is missing. An empty value is returned as is.
+func (c *Context) DefaultQuery(key, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetQuery returns the first value of the query key, and whether the
+// key exists, "/?name=" gives ("", true)
+func (c *Context) GetQuery(key string) (string, bool) {
+	if values, ok := c.GetQueryArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// QueryArray returns every value of the query key
+func (c *Context) QueryArray(key string) []string {
+	values, _ := c.GetQueryArray(key)
+	return values
+}
+
+// GetQueryArray returns every value of the query key, and whether there
+// is at least one
+func (c *Context) GetQueryArray(key string) ([]string, bool) {
+	c.initQueryCache()
+	values, ok := c.queryCache[key]
+	return values, ok && len(values) > 0
+}
+
+// QueryMap returns the query keys of the form key[name] as a map of
+// name to value, "/?ids[a]=1&ids[b]=2" gives {"a": "1", "b": "2"} for "ids"
+func (c *Context) QueryMap(key string) map[string]string {
+	dict, _ := c.GetQueryMap(key)
+	return dict
+}
+
+// GetQueryMap returns QueryMap(key), and whether there is at least one
+// matching key
+func (c *Context) GetQueryMap(key string) (map[string]string, bool) {
+	c.initQueryCache()
+	return valuesMap(c.queryCache, key)
+}
+
+// PostForm returns the first value of key in the urlencoded or multipart
+// body, or else in the query string, like http.Request.FormValue, or "".
+// The other PostForm methods read the same values, body values first,
+// GetBodyForm reads the body only.
 func (c *Context) PostForm(key string) string {
-	return c.Req.FormValue(key)
+	value, _ := c.GetPostForm(key)
+	return value
 }
 
-func (c *Context) Query(key string) string {
-	return c.Req.URL.Query().Get(key)
+// DefaultPostForm returns PostForm(key), or defaultValue when the key is
+// missing
+func (c *Context) DefaultPostForm(key, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetPostForm returns PostForm(key), and whether the key exists
+func (c *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := c.GetPostFormArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// PostFormArray returns every value of the key, those of the body first
+func (c *Context) PostFormArray(key string) []string {
+	values, _ := c.GetPostFormArray(key)
+	return values
 }
 
+// GetPostFormArray returns PostFormArray(key), and whether there is at
+// least one value
+func (c *Context) GetPostFormArray(key string) ([]string, bool) {
+	c.initFormCache()
+	values, ok := c.formCache[key]
+	return values, ok && len(values) > 0
+}
+
+// PostFormMap returns the keys of the form key[name] of the body and the
+// query as a map of name to value, see QueryMap
+func (c *Context) PostFormMap(key string) map[string]string {
+	dict, _ := c.GetPostFormMap(key)
+	return dict
+}
+
+// GetPostFormMap returns PostFormMap(key), and whether there is at least
+// one matching key
+func (c *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	c.initFormCache()
+	return valuesMap(c.formCache, key)
+}
+
+// GetBodyForm returns the first value of key in the urlencoded or
+// multipart body only, and whether the key exists there
+func (c *Context) GetBodyForm(key string) (string, bool) {
+	c.initFormCache()
+	if values := c.Req.PostForm[key]; len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// valuesMap collects the first values of the keys key[name] by name
+func valuesMap(values url.Values, key string) (map[string]string, bool) {
+	dict := make(map[string]string)
+	for k, v := range values {
+		if len(k) > len(key)+2 && strings.HasPrefix(k, key) && k[len(key)] == '[' && k[len(k)-1] == ']' {
+			if name := k[len(key)+1 : len(k)-1]; !strings.ContainsAny(name, "[]") && len(v) > 0 {
+				dict[name] = v[0]
+			}
+		}
+	}
+	return dict, len(dict) > 0
+}
+
+// Status sets the status code, the header is written with the first
+// write of the body or when the handlers return
 func (c *Context) Status(code int) {
-	c.StatusCode = code
 	c.Writer.WriteHeader(code)
 }
 
@@ -70,32 +417,312 @@ func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
 }
 
-func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
+// GetHeader returns the first value of the request header key
+func (c *Context) GetHeader(key string) string {
+	return c.Req.Header.Get(key)
+}
+
+// ContentType returns the Content-Type of the request without its
+// parameters, e.g. "application/json"
+func (c *Context) ContentType() string {
+	return filterFlags(c.GetHeader("Content-Type"))
+}
+
+// IsWebsocket reports whether the request asks for a websocket upgrade
+func (c *Context) IsWebsocket() bool {
+	return headerHasToken(c.Req.Header, "Connection", "upgrade") &&
+		strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+}
+
+// headerHasToken reports whether the comma separated values of the
+// header key contain token, case-insensitively
+func headerHasToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FullPath returns the pattern of the matched route, e.g.
+// "/assets/*filepath", or "" when no route matched
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
+// CookieOptions are the attributes of a cookie set by SetCookie
+type CookieOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int // seconds, 0 for a session cookie and < 0 to delete it
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// SetCookie adds a Set-Cookie header, value is URL-encoded. The cookie
+// gets engine.CookieDefaults, overridden by the fields set in opts, which
+// may be nil. Secure and HttpOnly of opts can only add the flags, a
+// cookie without a default flag is set with http.SetCookie.
+func (c *Context) SetCookie(name, value string, opts *CookieOptions) {
+	o := c.engine.CookieDefaults
+	if opts != nil {
+		if opts.Path != "" {
+			o.Path = opts.Path
+		}
+		if opts.Domain != "" {
+			o.Domain = opts.Domain
+		}
+		if opts.MaxAge != 0 {
+			o.MaxAge = opts.MaxAge
+		}
+		if opts.SameSite != 0 {
+			o.SameSite = opts.SameSite
+		}
+		o.Secure = o.Secure || opts.Secure
+		o.HttpOnly = o.HttpOnly || opts.HttpOnly
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	})
+}
+
+// Cookie returns the URL-decoded value of the named request cookie,
+// or http.ErrNoCookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// Redirect replies with a redirect to location, code must be a 3xx
+// status code
+func (c *Context) Redirect(code int, location string) {
+	if code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect {
+		panic(fmt.Sprintf("gee: cannot redirect with status code %d", code))
+	}
+	http.Redirect(c.Writer, c.Req, location, code)
+}
+
+// Render writes the header and the body rendered by r. The status code
+// is kept until the body is rendered, so a failing renderer gets a 500.
+func (c *Context) Render(code int, r Render) {
 	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	if !bodyAllowedForStatus(code) {
+		r.WriteContentType(c.Writer)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	if err := r.Render(c.Writer); err != nil {
+		c.Errors = append(c.Errors, err)
+		if !c.Writer.Written() {
+			http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		}
+	}
 }
 
+// bodyAllowedForStatus reports whether a response with this status
+// code may have a body, see RFC 7230 section 3.3
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// RenderFormat renders obj with the renderer registered for mimeType,
+// see RegisterRender
+func (c *Context) RenderFormat(code int, mimeType string, obj interface{}) {
+	factory, ok := lookupRender(mimeType)
+	if !ok {
+		c.Fail(http.StatusInternalServerError, "gee: no renderer registered for "+mimeType)
+		return
+	}
+	c.Render(code, factory(obj))
+}
+
+func (c *Context) String(code int, format string, values ...interface{}) {
+	c.Render(code, String{Format: format, Data: values})
+}
+
+// JSON renders obj as JSON. obj is encoded before the header is written,
+// so that an encoding error can still be reported with a 500.
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "application/json")
-	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
+	c.Render(code, JSON{Data: obj})
+}
+
+// IndentedJSON renders obj as pretty-printed JSON
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, IndentedJSON{Data: obj})
+}
+
+// SecureJSON renders obj as JSON and prefixes arrays with
+// engine.SecureJSONPrefix to prevent JSON hijacking
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	c.Render(code, SecureJSON{Prefix: c.engine.SecureJSONPrefix, Data: obj})
+}
+
+// AsciiJSON renders obj as JSON with non-ASCII characters escaped as \uXXXX
+func (c *Context) AsciiJSON(code int, obj interface{}) {
+	c.Render(code, AsciiJSON{Data: obj})
+}
+
+// PureJSON renders obj as JSON without escaping <, > and &
+func (c *Context) PureJSON(code int, obj interface{}) {
+	c.Render(code, PureJSON{Data: obj})
+}
+
+// jsonpCallback restricts callbacks to JavaScript identifiers and
+// member expressions such as "jQuery.cb_1"
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// JSONP renders obj as a call of the function named by the "callback"
+// query parameter, or as JSON without one. An invalid callback gets a 400.
+func (c *Context) JSONP(code int, obj interface{}) {
+	callback := c.Query("callback")
+	if callback == "" {
+		c.JSON(code, obj)
+		return
 	}
+	if len(callback) > 128 || !jsonpCallback.MatchString(callback) {
+		c.Fail(http.StatusBadRequest, "invalid JSONP callback")
+		return
+	}
+	c.Render(code, JSONP{Callback: callback, Data: obj})
+}
+
+// XML renders obj as XML
+func (c *Context) XML(code int, obj interface{}) {
+	c.Render(code, XML{Data: obj})
+}
+
+// YAML renders obj as YAML
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, YAML{Data: obj})
+}
+
+// MsgPack renders obj in the MessagePack format
+func (c *Context) MsgPack(code int, obj interface{}) {
+	c.Render(code, MsgPack{Data: obj})
 }
 
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, Data{Data: data})
 }
 
 // HTML template render
 // refer https://golang.org/pkg/html/template/
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(500, err.Error())
+	c.Render(code, HTML{Template: c.engine.htmlTemplates, Name: name, Data: data})
+}
+
+// File writes the named file with http.ServeFile, which answers Range,
+// If-Modified-Since and the other conditional requests
+func (c *Context) File(filepath string) {
+	http.ServeFile(c.Writer, c.Req, filepath)
+}
+
+// FileFromFS writes the file at filepath in fsys with http.ServeContent,
+// with the same support of range and conditional requests as File.
+// Directories are not listed, they get a 404.
+func (c *Context) FileFromFS(filepath string, fsys http.FileSystem) {
+	if !strings.HasPrefix(filepath, "/") {
+		filepath = "/" + filepath
+	}
+	f, err := fsys.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if info.IsDir() {
+		c.fileError(fs.ErrNotExist)
+		return
+	}
+	http.ServeContent(c.Writer, c.Req, info.Name(), info.ModTime(), f)
+}
+
+// fileError answers an error of opening a file like http.ServeFile
+func (c *Context) fileError(err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(c.Writer, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(c.Writer, "403 Forbidden", http.StatusForbidden)
+	default:
+		c.Errors = append(c.Errors, err)
+		http.Error(c.Writer, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// FileAttachment writes the named file like File, and asks the client to
+// download it as filename. Non-ASCII names are sent as filename* of
+// RFC 6266, with an ASCII fallback for old clients.
+func (c *Context) FileAttachment(filepath, filename string) {
+	c.SetHeader("Content-Disposition", contentDisposition("attachment", filename))
+	c.File(filepath)
+}
+
+// contentDisposition formats a Content-Disposition header value
+func contentDisposition(disposition, filename string) string {
+	fallback := make([]byte, 0, len(filename))
+	ascii := true
+	for _, r := range filename {
+		switch {
+		case r >= utf8.RuneSelf || r < 0x20 || r == 0x7f:
+			fallback = append(fallback, '_')
+			ascii = false
+		case r == '"' || r == '\\':
+			fallback = append(fallback, '\\', byte(r))
+		default:
+			fallback = append(fallback, byte(r))
+		}
+	}
+	value := disposition + `; filename="` + string(fallback) + `"`
+	if !ascii {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent-encodes s except for the attr-char of RFC 5987
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[ch>>4])
+		b.WriteByte(hex[ch&0x0f])
 	}
+	return b.String()
 }
@@ -0,0 +1,422 @@
+package gee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextAbort(t *testing.T) {
+	r := New()
+	var trace []string
+	r.Use(func(c *Context) {
+		trace = append(trace, "outer>")
+		c.Next()
+		trace = append(trace, "<outer")
+	})
+	auth := func(c *Context) {
+		trace = append(trace, "auth>")
+		c.Next()
+		trace = append(trace, "<auth")
+	}
+	deny := func(c *Context) {
+		trace = append(trace, "deny")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		trace = append(trace, "deny-done")
+	}
+	r.GET("/status", auth, deny, func(c *Context) { trace = append(trace, "handler") })
+	r.GET("/json", func(c *Context) {
+		c.AbortWithStatusJSON(http.StatusForbidden, H{"error": "forbidden"})
+	}, func(c *Context) { trace = append(trace, "handler") })
+	r.GET("/error", func(c *Context) {
+		c.AbortWithError(http.StatusBadGateway, errors.New("upstream down"))
+		if !c.IsAborted() || len(c.Errors) != 1 {
+			t.Fatal("AbortWithError should abort and record the error")
+		}
+	}, func(c *Context) { trace = append(trace, "handler") })
+
+	w := performRequest(r, "GET", "/status")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status should be 401, got %d", w.Code)
+	}
+	if got := strings.Join(trace, " "); got != "outer> auth> deny deny-done <auth <outer" {
+		t.Fatalf("unexpected order %q", got)
+	}
+
+	trace = nil
+	w = performRequest(r, "GET", "/json")
+	if w.Code != http.StatusForbidden || strings.TrimSpace(w.Body.String()) != `{"error":"forbidden"}` {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if got := strings.Join(trace, " "); got != "outer> <outer" {
+		t.Fatalf("unexpected order %q", got)
+	}
+
+	trace = nil
+	if w := performRequest(r, "GET", "/error"); w.Code != http.StatusBadGateway {
+		t.Fatalf("status should be 502, got %d", w.Code)
+	}
+	if got := strings.Join(trace, " "); got != "outer> <outer" {
+		t.Fatalf("unexpected order %q", got)
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {
+		c.Set("user", "geektutu")
+		c.Set("tenant", 42)
+		c.Set("admin", true)
+		c.Next()
+	})
+	r.GET("/me", func(c *Context) {
+		if c.GetString("user") != "geektutu" || c.GetInt("tenant") != 42 || !c.GetBool("admin") {
+			t.Fatalf("unexpected keys %v", c.Keys)
+		}
+		if c.GetString("tenant") != "" || c.GetInt64("tenant") != 0 {
+			t.Fatal("typed getters should return the zero value on a type mismatch")
+		}
+		if v, ok := Value[int](c, "tenant"); !ok || v != 42 {
+			t.Fatal("Value should return the typed value")
+		}
+		if _, ok := Value[string](c, "missing"); ok {
+			t.Fatal("Value should report a missing key")
+		}
+		if c.MustGet("user") != "geektutu" {
+			t.Fatal("MustGet should return the value")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	if w := performRequest(r, "GET", "/me"); w.Code != http.StatusOK {
+		t.Fatalf("status should be 200, got %d", w.Code)
+	}
+
+	c := r.allocateContext()
+	c.Set("user", "geektutu")
+	c.reset(nil, httptest.NewRequest("GET", "/", nil))
+	if c.Keys != nil {
+		t.Fatalf("keys should not survive reset: %v", c.Keys)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustGet should panic on a missing key")
+		}
+	}()
+	c.MustGet("user")
+}
+
+type ctxKey struct{}
+
+func TestContextImplementsContext(t *testing.T) {
+	var _ context.Context = &Context{}
+
+	r := New()
+	r.Use(func(c *Context) {
+		cancel := c.WithTimeout(50 * time.Millisecond)
+		defer cancel()
+		c.WithValue(ctxKey{}, "traced")
+		c.Set("user", "geektutu")
+		c.Next()
+	})
+	r.GET("/slow", func(c *Context) {
+		if _, ok := c.Deadline(); !ok {
+			t.Fatal("deadline set by middleware should be visible")
+		}
+		if c.Value(ctxKey{}) != "traced" || c.Req.Context().Value(ctxKey{}) != "traced" {
+			t.Fatal("WithValue should update the request context")
+		}
+		if c.Value("user") != "geektutu" {
+			t.Fatal("Value should read the key/value store")
+		}
+		select {
+		case <-c.Done():
+			if c.Err() != context.DeadlineExceeded {
+				t.Fatalf("unexpected error %v", c.Err())
+			}
+			c.Status(http.StatusGatewayTimeout)
+		case <-time.After(time.Second):
+			t.Fatal("the deadline should expire")
+		}
+	})
+
+	if w := performRequest(r, "GET", "/slow"); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status should be 504, got %d", w.Code)
+	}
+
+	// cancellation by the client is seen through Done as well
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	c := r.allocateContext()
+	c.reset(httptest.NewRecorder(), req)
+	if c.Err() != context.Canceled {
+		t.Fatalf("Err should be context.Canceled, got %v", c.Err())
+	}
+}
+
+func TestJSONRendering(t *testing.T) {
+	r := New()
+	r.GET("/json", func(c *Context) { c.JSON(http.StatusOK, H{"html": "<b>"}) })
+	r.GET("/bad", func(c *Context) { c.JSON(http.StatusOK, H{"ch": make(chan int)}) })
+	r.GET("/indented", func(c *Context) { c.IndentedJSON(http.StatusOK, H{"a": 1}) })
+	r.GET("/secure", func(c *Context) { c.SecureJSON(http.StatusOK, []int{1, 2}) })
+	r.GET("/ascii", func(c *Context) { c.AsciiJSON(http.StatusOK, H{"lang": "GO语言😀"}) })
+	r.GET("/pure", func(c *Context) { c.PureJSON(http.StatusOK, H{"html": "<b>"}) })
+	r.GET("/jsonp", func(c *Context) { c.JSONP(http.StatusOK, H{"a": 1}) })
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/json", 200, "application/json", `{"html":"\u003cb\u003e"}`},
+		{"/bad", 500, "text/plain; charset=utf-8", "json: unsupported type: chan int\n"},
+		{"/indented", 200, "application/json", "{\n    \"a\": 1\n}"},
+		{"/secure", 200, "application/json", "while(1);[1,2]"},
+		{"/ascii", 200, "application/json", `{"lang":"GO\u8bed\u8a00\ud83d\ude00"}`},
+		{"/pure", 200, "application/json", `{"html":"<b>"}`},
+		{"/jsonp", 200, "application/json", `{"a":1}`},
+		{"/jsonp?callback=jQuery.cb_1", 200, "application/javascript", `/**/ jQuery.cb_1({"a":1});`},
+		{"/jsonp?callback=alert(1)//", 400, "application/json", `{"message":"invalid JSONP callback"}`},
+	}
+	for _, tt := range tests {
+		w := performRequest(r, "GET", tt.path)
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Fatalf("%s: got %d %q %q", tt.path, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestContextCookies(t *testing.T) {
+	r := New()
+	r.GET("/set", func(c *Context) {
+		c.SetCookie("user", "gee tutu", nil)
+		c.SetCookie("token", "x", &CookieOptions{MaxAge: 60, Secure: true, SameSite: http.SameSiteStrictMode})
+	})
+	r.GET("/get", func(c *Context) {
+		user, err := c.Cookie("user")
+		_, missing := c.Cookie("missing")
+		c.String(http.StatusOK, "%s %v", user, err == nil && errors.Is(missing, http.ErrNoCookie))
+	})
+
+	w := performRequest(r, "GET", "/set")
+	cookies := w.Header().Values("Set-Cookie")
+	want := []string{
+		"user=gee+tutu; Path=/; HttpOnly; SameSite=Lax",
+		"token=x; Path=/; Max-Age=60; HttpOnly; Secure; SameSite=Strict",
+	}
+	if len(cookies) != 2 || cookies[0] != want[0] || cookies[1] != want[1] {
+		t.Fatalf("unexpected cookies %q", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.Header.Set("Cookie", "user=gee+tutu")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "gee tutu true" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestCookieDefaultsSurvivePartialOptions(t *testing.T) {
+	r := New()
+	r.CookieDefaults.Secure = true
+	r.CookieDefaults.Domain = "example.com"
+	r.GET("/set", func(c *Context) {
+		c.SetCookie("a", "b", &CookieOptions{MaxAge: 60})
+		c.SetCookie("c", "d", &CookieOptions{Path: "/admin", SameSite: http.SameSiteStrictMode})
+	})
+	cookies := performRequest(r, "GET", "/set").Header().Values("Set-Cookie")
+	want := []string{
+		"a=b; Path=/; Domain=example.com; Max-Age=60; HttpOnly; Secure; SameSite=Lax",
+		"c=d; Path=/admin; Domain=example.com; HttpOnly; Secure; SameSite=Strict",
+	}
+	if len(cookies) != 2 || cookies[0] != want[0] || cookies[1] != want[1] {
+		t.Fatalf("unexpected cookies %q", cookies)
+	}
+}
+
+func TestContextRequestHelpers(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	v1.GET("/assets/*filepath", func(c *Context) {
+		c.String(http.StatusOK, "%s %s %t", c.FullPath(), c.ContentType(), c.IsWebsocket())
+	})
+	r.Use(func(c *Context) {
+		if c.FullPath() == "" {
+			c.SetHeader("X-Full-Path", "none")
+		}
+		c.Next()
+	})
+
+	req := httptest.NewRequest("GET", "/v1/assets/css/site.css", nil)
+	req.Header.Set("Content-Type", "text/css; charset=utf-8")
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "WebSocket")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "/v1/assets/*filepath text/css true" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+
+	w = performRequest(r, "GET", "/unknown")
+	if w.Code != http.StatusNotFound || w.Header().Get("X-Full-Path") != "none" {
+		t.Fatalf("unmatched routes should have no full path, got %d %q", w.Code, w.Header().Get("X-Full-Path"))
+	}
+}
+
+func TestContextRedirect(t *testing.T) {
+	r := New()
+	r.GET("/old", func(c *Context) {
+		c.Redirect(http.StatusMovedPermanently, "/new")
+	})
+	w := performRequest(r, "GET", "/old")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/new" {
+		t.Fatalf("unexpected redirect %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Redirect with a 200 should panic")
+		}
+	}()
+	newBindContext("GET", "/", "", "").Redirect(http.StatusOK, "/new")
+}
+
+func TestContextFile(t *testing.T) {
+	dir := t.TempDir()
+	name := dir + "/report.txt"
+	if err := os.WriteFile(name, []byte("hello gee"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir+"/site", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/site/index.html", []byte("<h1>gee</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	var status int
+	r := New()
+	r.Use(func(c *Context) {
+		c.Next()
+		status = c.Writer.Status()
+	})
+	r.GET("/file", func(c *Context) { c.File(name) })
+	r.GET("/fs/*filepath", func(c *Context) { c.FileFromFS(c.Param("filepath"), http.Dir(dir)) })
+	r.GET("/download", func(c *Context) { c.FileAttachment(name, "报告 \"1\".txt") })
+
+	tests := []struct {
+		path   string
+		header string
+		value  string
+		code   int
+		body   string
+	}{
+		{"/file", "", "", http.StatusOK, "hello gee"},
+		{"/file", "Range", "bytes=6-", http.StatusPartialContent, "gee"},
+		{"/file", "If-Modified-Since", modTime.Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"/fs/report.txt", "Range", "bytes=0-4", http.StatusPartialContent, "hello"},
+		{"/fs/missing.txt", "", "", http.StatusNotFound, "404 page not found\n"},
+		{"/fs/report.txt", "If-Modified-Since", modTime.Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"/fs/site/index.html", "", "", http.StatusOK, "<h1>gee</h1>"},
+		{"/fs/site", "", "", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || status != tt.code || w.Body.String() != tt.body {
+			t.Fatalf("%s %s: got %d (tracked %d) %q", tt.path, tt.header, w.Code, status, w.Body.String())
+		}
+	}
+
+	w := performRequest(r, "GET", "/download")
+	want := `attachment; filename="__ \"1\".txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%20%221%22.txt`
+	if w.Header().Get("Content-Disposition") != want || w.Body.String() != "hello gee" {
+		t.Fatalf("unexpected attachment %q %q", w.Header().Get("Content-Disposition"), w.Body.String())
+	}
+	if got := contentDisposition("attachment", "report.txt"); got != `attachment; filename="report.txt"` {
+		t.Fatalf("unexpected ASCII disposition %q", got)
+	}
+}
+
+func TestContextQueryAndPostForm(t *testing.T) {
+	c := newBindContext("POST", "/?name=gee&empty=&tag=a&tag=b&ids[a]=1&ids[b]=2&ids[]=3&idsx[c]=4",
+		MIMEPOSTForm, "title=hello&tag=c&user[name]=tutu&user[age]=7")
+
+	if c.Query("name") != "gee" || c.Query("missing") != "" || c.Query("title") != "" {
+		t.Fatal("unexpected Query")
+	}
+	if c.DefaultQuery("empty", "x") != "" || c.DefaultQuery("missing", "x") != "x" {
+		t.Fatal("unexpected DefaultQuery")
+	}
+	if value, ok := c.GetQuery("empty"); value != "" || !ok {
+		t.Fatal("an empty query value should exist")
+	}
+	if _, ok := c.GetQuery("missing"); ok {
+		t.Fatal("a missing query key should not exist")
+	}
+	if tags := c.QueryArray("tag"); len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Fatalf("unexpected QueryArray %q", tags)
+	}
+	if ids := c.QueryMap("ids"); len(ids) != 2 || ids["a"] != "1" || ids["b"] != "2" {
+		t.Fatalf("unexpected QueryMap %v", ids)
+	}
+	if _, ok := c.GetQueryMap("missing"); ok {
+		t.Fatal("a missing query map should not exist")
+	}
+
+	// PostForm reads the body, then the query, like Request.FormValue
+	if c.PostForm("title") != "hello" || c.PostForm("name") != "gee" || c.PostForm("tag") != "c" {
+		t.Fatal("PostForm should read the body, then the query")
+	}
+	if value, ok := c.GetBodyForm("title"); value != "hello" || !ok {
+		t.Fatal("unexpected GetBodyForm")
+	}
+	if _, ok := c.GetBodyForm("name"); ok {
+		t.Fatal("GetBodyForm should only read the body")
+	}
+	if c.DefaultPostForm("missing", "x") != "x" {
+		t.Fatal("unexpected DefaultPostForm")
+	}
+	if tags := c.PostFormArray("tag"); len(tags) != 3 || tags[0] != "c" || tags[1] != "a" || tags[2] != "b" {
+		t.Fatalf("unexpected PostFormArray %q", tags)
+	}
+	if user := c.PostFormMap("user"); len(user) != 2 || user["name"] != "tutu" || user["age"] != "7" {
+		t.Fatalf("unexpected PostFormMap %v", user)
+	}
+
+	// the query is parsed once, until the Context is reset
+	c.Req.URL.RawQuery = "name=tutu"
+	if c.Query("name") != "gee" {
+		t.Fatal("the query should be cached")
+	}
+	c.reset(httptest.NewRecorder(), httptest.NewRequest("GET", "/?name=tutu", nil))
+	if c.Query("name") != "tutu" || c.PostForm("title") != "" || c.PostForm("name") != "tutu" {
+		t.Fatal("the caches should be cleared by reset")
+	}
+}
+
+func TestPostFormReadsQueryOnGet(t *testing.T) {
+	r := New()
+	r.GET("/x", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.PostForm("q"))
+	})
+	if w := performRequest(r, "GET", "/x?q=1"); w.Body.String() != "1" {
+		t.Fatalf("PostForm should read the query like FormValue, got %q", w.Body.String())
+	}
+}
@@ -1,11 +1,19 @@
 package gee
 
 import (
+	"context"
+	"errors"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type HandlerFunc func(ctx *Context)
@@ -20,19 +28,80 @@ type RouterGroup struct {
 type Engine struct {
 	*RouterGroup
 	router        *router
-	groups        []*RouterGroup     // store all groups
 	htmlTemplates *template.Template // for html render
 	funcMap       template.FuncMap   // for html render
+	pool          sync.Pool          // recycles Contexts
+
+	// HandleMethodNotAllowed replies 405 with an Allow header, instead of 404,
+	// when the path is registered for other methods only. Enabled by New.
+	HandleMethodNotAllowed bool
+	// HandleOPTIONS answers OPTIONS requests with the Allow set of the path,
+	// unless an OPTIONS route is registered for it. Enabled by New.
+	HandleOPTIONS bool
+	// HandleHEAD answers HEAD requests with the matching GET handler and
+	// discards the body, unless a HEAD route is registered. Enabled by New.
+	HandleHEAD bool
+	// SecureJSONPrefix is written before JSON arrays by Context.SecureJSON,
+	// "while(1);" by default
+	SecureJSONPrefix string
+	// CookieDefaults are the options of Context.SetCookie when it is
+	// given none: path "/", HttpOnly and SameSite=Lax by New
+	CookieDefaults CookieOptions
+	// MaxMultipartMemory is the memory used by a multipart form, the
+	// files beyond it are stored on disk. 32 MB by default.
+	MaxMultipartMemory int64
+	// MaxUploadSize caps the form bodies read by the form and upload
+	// methods of Context, larger bodies are answered with 413. 0, the
+	// default, enforces no limit.
+	MaxUploadSize int64
+	// WSCheckOrigin accepts or refuses the Origin of websocket handshakes,
+	// nil accepts the requests without Origin and those of the same host
+	WSCheckOrigin func(r *http.Request) bool
+	// HandleSignals makes RunContext shut down on SIGINT and SIGTERM
+	HandleSignals bool
+	// ShutdownTimeout bounds the draining of the connections when the
+	// context of RunContext is done, 10 seconds by default
+	ShutdownTimeout time.Duration
+
+	serverMu     sync.Mutex
+	server       *http.Server // the running server, nil when stopped
+	shutdownDone chan error   // receives the result of Shutdown
+	onStart      []func() error
+	onShutdown   []func(ctx context.Context) error
 }
 
 // New is the constructor of gee.Engine
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:                 newRouter(),
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+		HandleHEAD:             true,
+		SecureJSONPrefix:       "while(1);",
+		MaxMultipartMemory:     defaultMultipartMemory,
+		ShutdownTimeout:        10 * time.Second,
+		CookieDefaults: CookieOptions{
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
-	engine.groups = []*RouterGroup{engine.RouterGroup}
+	engine.pool.New = func() interface{} {
+		return engine.allocateContext()
+	}
 	return engine
 }
 
+func (engine *Engine) allocateContext() *Context {
+	c := &Context{
+		Params: make(Params, 0, engine.router.maxParams),
+		engine: engine,
+	}
+	c.writermem.mirror = &c.StatusCode
+	return c
+}
+
 // Group is defined to create a new RouterGroup
 // remember all groups share the same Engine instance
 func (group *RouterGroup) Group(prefix string) *RouterGroup {
@@ -42,29 +111,105 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 		parent: group,
 		engine: engine,
 	}
-	engine.groups = append(engine.groups, newGroup)
 	return newGroup
 }
 
-// Use is defined to add middleware to the group
+// Use is defined to add middleware to the group,
+// routes registered before the call get it as well
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
+	engine := group.engine
+	engine.router.rebuild(engine.middlewares)
+}
+
+// combineHandlers returns the middleware of the group and of its
+// ancestors, outermost first, followed by handlers
+func (group *RouterGroup) combineHandlers(handlers ...HandlerFunc) []HandlerFunc {
+	size := len(handlers)
+	for g := group; g != nil; g = g.parent {
+		size += len(g.middlewares)
+	}
+	merged := make([]HandlerFunc, size)
+	i := size - len(handlers)
+	copy(merged[i:], handlers)
+	for g := group; g != nil; g = g.parent {
+		i -= len(g.middlewares)
+		copy(merged[i:], g.middlewares)
+	}
+	return merged
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// addRoute panics if the route has no handler or conflicts with a
+// registered one
+func (group *RouterGroup) addRoute(method string, comp string, handlers []HandlerFunc) {
 	pattern := group.prefix + comp
+	if len(handlers) == 0 {
+		panic("gee: route " + method + " " + pattern + " has no handler")
+	}
 	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	if err := group.engine.router.addRoute(method, pattern, newRoute(group, handlers)); err != nil {
+		panic(err)
+	}
+}
+
+// anyMethods are the methods registered by RouterGroup.Any
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete,
+	http.MethodConnect, http.MethodTrace,
+}
+
+// Handle registers a new request handle with the given method and pattern.
+// The handlers before the last one are route-level middleware, they run
+// after the group middleware. GET, POST, PUT etc. are shortcuts for it.
+func (group *RouterGroup) Handle(method string, pattern string, handlers ...HandlerFunc) {
+	if method == "" || strings.ToUpper(method) != method {
+		panic("gee: http method " + method + " is not valid")
+	}
+	group.addRoute(method, pattern, handlers)
 }
 
 // GET defines the method to add GET request
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodGet, pattern, handlers)
 }
 
 // POST defines the method to add POST request
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPost, pattern, handlers)
+}
+
+// PUT defines the method to add PUT request
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPut, pattern, handlers)
+}
+
+// DELETE defines the method to add DELETE request
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodDelete, pattern, handlers)
+}
+
+// PATCH defines the method to add PATCH request
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodPatch, pattern, handlers)
+}
+
+// HEAD defines the method to add HEAD request
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodHead, pattern, handlers)
+}
+
+// OPTIONS defines the method to add OPTIONS request
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) {
+	group.addRoute(http.MethodOptions, pattern, handlers)
+}
+
+// Any registers the handler for all http methods,
+// GET, POST, PUT, PATCH, HEAD, OPTIONS, DELETE, CONNECT, TRACE
+func (group *RouterGroup) Any(pattern string, handlers ...HandlerFunc) {
+	for _, method := range anyMethods {
+		group.addRoute(method, pattern, handlers)
+	}
 }
 
 // 解析请求的地址，映射到服务器上文件的真实地址，交给http.FileServer处理
@@ -100,20 +245,130 @@ func (engine *Engine) LoadHTMLGlob(pattern string) {
 	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
 }
 
-// Run defines the method to start a http server
+// ErrEngineNotRunning is returned by Shutdown when the engine does not serve
+var ErrEngineNotRunning = errors.New("gee: engine not running")
+
+// OnStart adds hooks run in order before the engine starts serving,
+// the first error stops the start
+func (engine *Engine) OnStart(hooks ...func() error) {
+	engine.onStart = append(engine.onStart, hooks...)
+}
+
+// OnShutdown adds hooks run in order once the connections are drained,
+// e.g. to close database pools and then flush the logs. They all run,
+// the first error is returned by Shutdown. Their context is bounded by
+// ShutdownTimeout on its own, so they still get a live context when the
+// draining ran out of time.
+func (engine *Engine) OnShutdown(hooks ...func(ctx context.Context) error) {
+	engine.onShutdown = append(engine.onShutdown, hooks...)
+}
+
+// Run defines the method to start a http server, see RunContext
 func (engine *Engine) Run(addr string) (err error) {
-	return http.ListenAndServe(addr, engine)
+	return engine.RunContext(context.Background(), addr)
 }
 
-func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var middlewares []HandlerFunc
-	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
+// RunContext serves on addr until ctx is done, or Shutdown is called,
+// and then shuts the engine down gracefully. It returns once the engine
+// is shut down, OnShutdown hooks included, with the error of Shutdown.
+func (engine *Engine) RunContext(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(ctx, ln)
+}
+
+// RunListener is RunContext on an open listener, it closes ln
+func (engine *Engine) RunListener(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: engine}
+	engine.serverMu.Lock()
+	if engine.server != nil {
+		engine.serverMu.Unlock()
+		ln.Close()
+		return errors.New("gee: engine already running")
+	}
+	done := make(chan error, 1)
+	engine.server, engine.shutdownDone = srv, done
+	engine.serverMu.Unlock()
+
+	for _, hook := range engine.onStart {
+		if err := hook(); err != nil {
+			engine.serverMu.Lock()
+			engine.server, engine.shutdownDone = nil, nil
+			engine.serverMu.Unlock()
+			ln.Close()
+			return err
 		}
 	}
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
+
+	if engine.HandleSignals {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			// Shutdown was called, wait until it is over
+			return <-done
+		}
+		engine.serverMu.Lock()
+		engine.server, engine.shutdownDone = nil, nil
+		engine.serverMu.Unlock()
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := engine.shutdownContext()
+		defer cancel()
+		if err := engine.Shutdown(shutdownCtx); err != ErrEngineNotRunning {
+			return err
+		}
+		// Shutdown was called meanwhile
+		return <-done
+	}
+}
+
+// shutdownContext is bounded by ShutdownTimeout, if positive
+func (engine *Engine) shutdownContext() (context.Context, context.CancelFunc) {
+	if engine.ShutdownTimeout > 0 {
+		return context.WithTimeout(context.Background(), engine.ShutdownTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Shutdown stops accepting connections, waits for the active requests
+// until ctx is done and then runs the OnShutdown hooks. Hijacked
+// connections, websockets included, are not waited for.
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.serverMu.Lock()
+	srv, done := engine.server, engine.shutdownDone
+	engine.server, engine.shutdownDone = nil, nil
+	engine.serverMu.Unlock()
+	if srv == nil {
+		return ErrEngineNotRunning
+	}
+
+	err := srv.Shutdown(ctx)
+	hookCtx, cancel := engine.shutdownContext()
+	defer cancel()
+	for _, hook := range engine.onShutdown {
+		if hookErr := hook(hookCtx); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+	done <- err
+	return err
+}
+
+func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
 	engine.router.handle(c)
+	c.Writer.WriteHeaderNow()
+	engine.pool.Put(c)
 }
@@ -0,0 +1,408 @@
+package gee
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func performRequest(engine *Engine, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestNestedGroup(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	v2 := v1.Group("/v2")
+	v3 := v2.Group("/v3")
+	if v2.prefix != "/v1/v2" {
+		t.Fatal("v2 prefix should be /v1/v2")
+	}
+	if v3.prefix != "/v1/v2/v3" {
+		t.Fatal("v3 prefix should be /v1/v2/v3")
+	}
+}
+
+func TestRouterGroupMethods(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	methods := map[string]func(string, ...HandlerFunc){
+		http.MethodGet:     v1.GET,
+		http.MethodPost:    v1.POST,
+		http.MethodPut:     v1.PUT,
+		http.MethodDelete:  v1.DELETE,
+		http.MethodPatch:   v1.PATCH,
+		http.MethodHead:    v1.HEAD,
+		http.MethodOptions: v1.OPTIONS,
+	}
+	for method, register := range methods {
+		method := method
+		register("/users/:id", func(c *Context) {
+			c.String(http.StatusOK, "%s %s", method, c.Param("id"))
+		})
+	}
+	for method := range methods {
+		w := performRequest(r, method, "/v1/users/42")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status should be 200, got %d", method, w.Code)
+		}
+		if method != http.MethodHead && w.Body.String() != method+" 42" {
+			t.Fatalf("%s: unexpected body %q", method, w.Body.String())
+		}
+	}
+}
+
+func TestRouterGroupAnyAndHandle(t *testing.T) {
+	r := New()
+	r.Any("/any", func(c *Context) {
+		c.String(http.StatusOK, c.Method)
+	})
+	r.Handle("PROPFIND", "/dav", func(c *Context) {
+		c.String(http.StatusMultiStatus, "dav")
+	})
+	for _, method := range anyMethods {
+		if w := performRequest(r, method, "/any"); w.Code != http.StatusOK {
+			t.Fatalf("Any should register %s, got %d", method, w.Code)
+		}
+	}
+	if w := performRequest(r, "PROPFIND", "/dav"); w.Code != http.StatusMultiStatus {
+		t.Fatalf("Handle should register PROPFIND, got %d", w.Code)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", func(c *Context) {})
+	r.PUT("/users/:id", func(c *Context) {})
+	r.POST("/users", func(c *Context) {})
+
+	w := performRequest(r, http.MethodDelete, "/users/1")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status should be 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("Allow should be \"GET, HEAD, OPTIONS, PUT\", got %q", allow)
+	}
+
+	if w := performRequest(r, http.MethodDelete, "/posts/1"); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown path should be 404, got %d", w.Code)
+	}
+
+	r.HandleMethodNotAllowed = false
+	if w := performRequest(r, http.MethodDelete, "/users/1"); w.Code != http.StatusNotFound {
+		t.Fatalf("status should be 404 when disabled, got %d", w.Code)
+	}
+}
+
+func TestAutomaticOptionsAndHead(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", func(c *Context) {
+		c.SetHeader("X-User", c.Param("id"))
+		c.String(http.StatusOK, "user %s", c.Param("id"))
+	})
+	r.POST("/users/:id", func(c *Context) {})
+	r.POST("/upload", func(c *Context) {})
+
+	w := performRequest(r, http.MethodOptions, "/users/1")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("OPTIONS status should be 204, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Fatalf("unexpected Allow %q", allow)
+	}
+	if allow := performRequest(r, http.MethodOptions, "/upload").Header().Get("Allow"); allow != "OPTIONS, POST" {
+		t.Fatalf("unexpected Allow %q", allow)
+	}
+	if w := performRequest(r, http.MethodOptions, "/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("OPTIONS on unknown path should be 404, got %d", w.Code)
+	}
+
+	w = performRequest(r, http.MethodHead, "/users/7")
+	if w.Code != http.StatusOK || w.Header().Get("X-User") != "7" {
+		t.Fatalf("HEAD should run the GET handler, got %d %v", w.Code, w.Header())
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("HEAD body should be empty, got %q", w.Body.String())
+	}
+
+	// explicit routes override the automatic replies
+	r.OPTIONS("/upload", func(c *Context) {
+		c.SetHeader("Access-Control-Allow-Origin", "*")
+		c.Status(http.StatusOK)
+	})
+	r.HEAD("/users/:id", func(c *Context) {
+		c.Status(http.StatusTeapot)
+	})
+	w = performRequest(r, http.MethodOptions, "/upload")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("OPTIONS route should override, got %d %v", w.Code, w.Header())
+	}
+	if w := performRequest(r, http.MethodHead, "/users/7"); w.Code != http.StatusTeapot {
+		t.Fatalf("HEAD route should override, got %d", w.Code)
+	}
+
+	r.HandleOPTIONS = false
+	if w := performRequest(r, http.MethodOptions, "/users/1"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("OPTIONS should be 405 when disabled, got %d", w.Code)
+	}
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func TestContextPoolReset(t *testing.T) {
+	r := New()
+	r.GET("/users/:id/posts/:post", func(c *Context) {
+		c.String(http.StatusCreated, "%s", c.Param("post"))
+	})
+	r.GET("/ping", func(c *Context) {
+		if len(c.Params) != 0 || c.Writer.Written() || c.Writer.Status() != http.StatusOK || c.index != len(c.handlers)-1 {
+			t.Fatalf("context leaked state: params=%v status=%d index=%d", c.Params, c.Writer.Status(), c.index)
+		}
+		c.String(http.StatusOK, "pong")
+	})
+	performRequest(r, "GET", "/users/1/posts/2")
+	if w := performRequest(r, "GET", "/ping"); w.Body.String() != "pong" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestServeHTTPAllocations(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) { c.Next() })
+	r.GET("/repos/:owner/:repo", func(c *Context) {})
+	req := httptest.NewRequest("GET", "/repos/geektutu/gee", nil)
+	w := &discardResponseWriter{header: make(http.Header)}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.ServeHTTP(w, req)
+	})
+	if allocs != 0 {
+		t.Fatalf("ServeHTTP should not allocate in steady state, got %v allocs", allocs)
+	}
+}
+
+func TestMiddlewareBoundToRoutes(t *testing.T) {
+	r := New()
+	var trace []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) {
+			trace = append(trace, name)
+			c.Next()
+		}
+	}
+	r.Use(mark("global"))
+	v1 := r.Group("/v1")
+	v1.Use(mark("v1"))
+	v1.GET("/users", func(c *Context) { trace = append(trace, "users") })
+	r.GET("/v10/users", func(c *Context) { trace = append(trace, "v10") })
+	r.GET("/v1beta", func(c *Context) { trace = append(trace, "v1beta") })
+	admin := v1.Group("/admin")
+	admin.GET("/stats", func(c *Context) { trace = append(trace, "stats") })
+	// Use after registration still applies to the routes of the group
+	admin.Use(mark("admin"))
+
+	tests := []struct {
+		path  string
+		trace string
+	}{
+		{"/v1/users", "global v1 users"},
+		{"/v10/users", "global v10"},
+		{"/v1beta", "global v1beta"},
+		{"/v1/admin/stats", "global v1 admin stats"},
+		{"/v1/missing", "global"},
+	}
+	for _, tt := range tests {
+		trace = nil
+		performRequest(r, "GET", tt.path)
+		if got := strings.Join(trace, " "); got != tt.trace {
+			t.Fatalf("%s: middleware should be %q, got %q", tt.path, tt.trace, got)
+		}
+	}
+}
+
+func TestRouteLevelMiddleware(t *testing.T) {
+	r := New()
+	var trace []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) {
+			trace = append(trace, name+">")
+			c.Next()
+			trace = append(trace, "<"+name)
+		}
+	}
+	api := r.Group("/api")
+	api.Use(mark("group"))
+	api.GET("/private", mark("auth"), mark("audit"), func(c *Context) {
+		trace = append(trace, "handler")
+	})
+	api.GET("/public", func(c *Context) {
+		trace = append(trace, "handler")
+	})
+
+	performRequest(r, "GET", "/api/private")
+	if got := strings.Join(trace, " "); got != "group> auth> audit> handler <audit <auth <group" {
+		t.Fatalf("unexpected order %q", got)
+	}
+	trace = nil
+	performRequest(r, "GET", "/api/public")
+	if got := strings.Join(trace, " "); got != "group> handler <group" {
+		t.Fatalf("route middleware should not leak to other routes, got %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a route without handler should panic")
+		}
+	}()
+	api.GET("/empty")
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	var events []string
+	var mu sync.Mutex
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := New()
+	r.GET("/slow", func(c *Context) {
+		close(started)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	r.OnStart(func() error { record("start"); return nil })
+	r.OnShutdown(
+		func(ctx context.Context) error { record("close db"); return nil },
+		func(ctx context.Context) error { record("flush logs"); return nil },
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- r.RunListener(ctx, ln) }()
+
+	resp := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			resp <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		resp <- string(body)
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	record("release")
+	close(release)
+
+	if body := <-resp; body != "done" {
+		t.Fatalf("the in-flight request should complete, got %q", body)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("RunListener should return nil once shut down, got %v", err)
+	}
+	if got := strings.Join(events, ","); got != "start,release,close db,flush logs" {
+		t.Fatalf("unexpected lifecycle %s", got)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+		t.Fatal("the engine should not accept connections after the shutdown")
+	}
+	if err := r.Shutdown(context.Background()); err != ErrEngineNotRunning {
+		t.Fatalf("expected ErrEngineNotRunning, got %v", err)
+	}
+}
+
+func TestShutdownAndStartErrors(t *testing.T) {
+	r := New()
+	hookErr := errors.New("db unavailable")
+	r.OnStart(func() error { return hookErr })
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	if err := r.RunListener(context.Background(), ln); err != hookErr {
+		t.Fatalf("expected the start hook error, got %v", err)
+	}
+
+	r = New()
+	r.OnShutdown(func(ctx context.Context) error { return hookErr })
+	ln, _ = net.Listen("tcp", "127.0.0.1:0")
+	runErr := make(chan error, 1)
+	go func() { runErr <- r.RunListener(context.Background(), ln) }()
+	waitRunning(r)
+	if err := r.Shutdown(context.Background()); err != hookErr {
+		t.Fatalf("expected the shutdown hook error, got %v", err)
+	}
+	if err := <-runErr; err != hookErr {
+		t.Fatalf("RunListener should return the error of Shutdown, got %v", err)
+	}
+}
+
+func waitRunning(r *Engine) {
+	for {
+		r.serverMu.Lock()
+		running := r.server != nil
+		r.serverMu.Unlock()
+		if running {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExternalShutdown(t *testing.T) {
+	r := New()
+	var hookDone bool
+	var hookCtxErr error
+	r.OnShutdown(func(ctx context.Context) error {
+		time.Sleep(200 * time.Millisecond)
+		hookCtxErr = ctx.Err()
+		hookDone = true
+		return nil
+	})
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	runErr := make(chan error, 1)
+	go func() { runErr <- r.RunListener(context.Background(), ln) }()
+	waitRunning(r)
+
+	// the hooks get a live context even when the draining context is over
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- r.Shutdown(expired) }()
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("RunListener should return nil after Shutdown, got %v", err)
+	}
+	if !hookDone {
+		t.Fatal("RunListener returned before the OnShutdown hooks ran")
+	}
+	if hookCtxErr != nil {
+		t.Fatalf("the hooks should get a live context, got %v", hookCtxErr)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("unexpected Shutdown error %v", err)
+	}
+}
@@ -12,6 +12,9 @@ func Logger() HandlerFunc {
 		// Process request
 		c.Next()
 		// Calculate resolution time
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		log.Printf("[%d] %s in %v", c.Writer.Status(), c.Req.RequestURI, time.Since(t))
+		for _, err := range c.Errors {
+			log.Printf("[%d] %s error: %v", c.Writer.Status(), c.Req.RequestURI, err)
+		}
 	}
 }
@@ -0,0 +1,246 @@
+package gee
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// marshalMsgPack encodes v in the MessagePack format. Integers use their
+// smallest encoding, time.Time the timestamp extension, struct fields
+// their msgpack tag, "name,omitempty" and "-" included, or their name.
+func marshalMsgPack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) write(b ...byte) {
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) writeUint16(code byte, n uint16) {
+	e.buf = binary.BigEndian.AppendUint16(append(e.buf, code), n)
+}
+
+func (e *msgpackEncoder) writeUint32(code byte, n uint32) {
+	e.buf = binary.BigEndian.AppendUint32(append(e.buf, code), n)
+}
+
+func (e *msgpackEncoder) writeUint64(code byte, n uint64) {
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, code), n)
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			e.write(0xc0)
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		e.write(0xc0)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		e.encodeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.write(0xc3)
+		} else {
+			e.write(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.writeUint32(0xca, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.writeUint64(0xcb, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("gee: cannot encode %s as MessagePack", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.write(byte(n)) // negative fixint
+	case n >= math.MinInt8:
+		e.write(0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.writeUint16(0xd1, uint16(n))
+	case n >= math.MinInt32:
+		e.writeUint32(0xd2, uint32(n))
+	default:
+		e.writeUint64(0xd3, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.write(byte(n)) // positive fixint
+	case n <= math.MaxUint8:
+		e.write(0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint16(0xcd, uint16(n))
+	case n <= math.MaxUint32:
+		e.writeUint32(0xce, uint32(n))
+	default:
+		e.writeUint64(0xcf, n)
+	}
+}
+
+// encodeLen writes the header of an array or a map, fix is the code of
+// the fixed format holding up to 15 elements
+func (e *msgpackEncoder) encodeLen(n int, fix, code16, code32 byte) {
+	switch {
+	case n < 16:
+		e.write(fix | byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint16(code16, uint16(n))
+	default:
+		e.writeUint32(code32, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		e.write(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.write(0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint16(0xda, uint16(n))
+	default:
+		e.writeUint32(0xdb, uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.write(0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint16(0xc5, uint16(n))
+	default:
+		e.writeUint32(0xc6, uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// encodeTime uses the timestamp extension, type -1, in its smallest form
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		e.write(0xd6, 0xff)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(sec))
+	case sec >= 0 && sec>>34 == 0:
+		e.write(0xd7, 0xff)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, nsec<<34|uint64(sec))
+	default:
+		e.write(0xc7, 12, 0xff)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(nsec))
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(sec))
+	}
+}
+
+// encodeMap sorts string keys, so that the output is deterministic
+func (e *msgpackEncoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	if v.Type().Key().Kind() == reflect.String {
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	}
+	e.encodeLen(len(keys), 0x80, 0xde, 0xdf)
+	for _, key := range keys {
+		if err := e.encode(key); err != nil {
+			return err
+		}
+		if err := e.encode(v.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	t := v.Type()
+	names := make([]string, 0, t.NumField())
+	fields := make([]reflect.Value, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("msgpack"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fv := v.Field(i)
+		if opts == "omitempty" && isEmpty(fv) {
+			continue
+		}
+		names = append(names, name)
+		fields = append(fields, fv)
+	}
+	e.encodeLen(len(names), 0x80, 0xde, 0xdf)
+	for i, name := range names {
+		e.encodeString(name)
+		if err := e.encode(fields[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package gee
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate describes the formats offered by Context.Negotiate and the
+// data of each. A format without its own data falls back to Data.
+type Negotiate struct {
+	Offered  []string // MIME types in order of preference, e.g. MIMEJSON
+	HTMLName string   // the template rendered for MIMEHTML
+	HTML     interface{}
+	JSON     interface{}
+	XML      interface{}
+	YAML     interface{}
+	Data     interface{}
+}
+
+// Negotiate renders the offered format that best matches the Accept
+// header of the request. It aborts with 406 when none is acceptable.
+// Formats other than HTML, JSON, XML and YAML use the renderers
+// registered with RegisterRender.
+func (c *Context) Negotiate(code int, config Negotiate) {
+	format := c.NegotiateFormat(config.Offered...)
+	switch format {
+	case "":
+		c.Fail(http.StatusNotAcceptable, "none of the accepted formats is offered")
+	case MIMEHTML:
+		c.HTML(code, config.HTMLName, negotiateData(config.HTML, config.Data))
+	case MIMEJSON:
+		c.JSON(code, negotiateData(config.JSON, config.Data))
+	case MIMEXML, MIMEXML2:
+		c.XML(code, negotiateData(config.XML, config.Data))
+	case MIMEYAML:
+		c.YAML(code, negotiateData(config.YAML, config.Data))
+	default:
+		c.RenderFormat(code, format, config.Data)
+	}
+}
+
+func negotiateData(data, fallback interface{}) interface{} {
+	if data != nil {
+		return data
+	}
+	return fallback
+}
+
+// NegotiateFormat returns the offer that best matches the Accept header,
+// following the q-values and wildcards of RFC 7231 section 5.3.2. Ties
+// go to the first offer, a missing Accept header accepts the first offer.
+// It returns "" when no offer is acceptable.
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	header := c.Req.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return offered[0]
+	}
+	accepted := parseAccept(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		if q := acceptQuality(accepted, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptRange is a media range of the Accept header with its q-value
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the media ranges of an Accept header, the ranges
+// with an invalid q-value are ignored
+func parseAccept(header string) []acceptRange {
+	ranges := make([]acceptRange, 0, strings.Count(header, ",")+1)
+	for _, part := range strings.Split(header, ",") {
+		media, params, _ := strings.Cut(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(media)), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		r := acceptRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(key)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				r.q = -1
+			} else {
+				r.q = q
+			}
+		}
+		if r.q >= 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific range matching
+// offer, "text/html" before "text/*" before "*/*", or 0 if none does
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+	typ, subtype, _ := strings.Cut(strings.ToLower(filterFlags(offer)), "/")
+	q, specificity := 0.0, 0
+	for _, r := range ranges {
+		s := 0
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 3
+		case r.typ == typ && r.subtype == "*":
+			s = 2
+		case r.typ == "*":
+			s = 1
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
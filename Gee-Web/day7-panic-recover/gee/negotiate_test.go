@@ -0,0 +1,64 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	offered := []string{MIMEJSON, MIMEXML, MIMEHTML}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MIMEJSON},
+		{"*/*", MIMEJSON},
+		{"application/xml", MIMEXML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", MIMEHTML},
+		{"application/json;q=0.5, application/xml;q=0.8", MIMEXML},
+		{"text/*", MIMEHTML},
+		{"*/*;q=0.1, application/json;q=0", MIMEXML},
+		{"Application/XML", MIMEXML},
+		{"application/xml;q=abc, text/html", MIMEHTML},
+		{"image/png", ""},
+	}
+	for _, tt := range tests {
+		c := newBindContext("GET", "/", "", "")
+		c.Req.Header.Set("Accept", tt.accept)
+		if got := c.NegotiateFormat(offered...); got != tt.want {
+			t.Fatalf("Accept %q: got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := New()
+	r.GET("/user", func(c *Context) {
+		c.Negotiate(http.StatusOK, Negotiate{
+			Offered: []string{MIMEJSON, MIMEXML, MIMEYAML},
+			XML:     H{"name": "gee"},
+			Data:    map[string]string{"name": "tutu"},
+		})
+	})
+	tests := []struct {
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"application/json", http.StatusOK, MIMEJSON, `{"name":"tutu"}`},
+		{"application/xml", http.StatusOK, MIMEXML, "<map><name>gee</name></map>"},
+		{"application/x-yaml", http.StatusOK, MIMEYAML + "; charset=utf-8", "name: tutu\n"},
+		{"text/html", http.StatusNotAcceptable, MIMEJSON, `{"message":"none of the accepted formats is offered"}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/user", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Fatalf("Accept %q: got %d %q %q", tt.accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Content-Type MIME of the rendered formats, besides those of binding
+const (
+	MIMEHTML    = "text/html"
+	MIMEPlain   = "text/plain"
+	MIMEYAML    = "application/x-yaml"
+	MIMEMsgPack = "application/x-msgpack"
+)
+
+// Render writes a response body in a given format. Render should encode
+// the whole body before writing, so that an error can still be answered
+// with a 500 by Context.Render.
+type Render interface {
+	Render(http.ResponseWriter) error
+	WriteContentType(w http.ResponseWriter)
+}
+
+// RenderFactory returns the Render of obj in a registered format
+type RenderFactory func(obj interface{}) Render
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]RenderFactory{
+		MIMEJSON:    func(obj interface{}) Render { return JSON{Data: obj} },
+		MIMEXML:     func(obj interface{}) Render { return XML{Data: obj} },
+		MIMEXML2:    func(obj interface{}) Render { return XML{Data: obj} },
+		MIMEYAML:    func(obj interface{}) Render { return YAML{Data: obj} },
+		MIMEMsgPack: func(obj interface{}) Render { return MsgPack{Data: obj} },
+	}
+)
+
+// RegisterRender makes a format available to Context.RenderFormat under
+// its MIME type, e.g. "application/toml" or "application/x-protobuf".
+// It replaces the built-in renderer of the same MIME type.
+func RegisterRender(mimeType string, factory RenderFactory) {
+	if mimeType == "" || factory == nil {
+		panic("gee: invalid renderer for " + mimeType)
+	}
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[mimeType] = factory
+}
+
+func lookupRender(mimeType string) (RenderFactory, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	factory, ok := renderers[mimeType]
+	return factory, ok
+}
+
+func writeContentType(w http.ResponseWriter, value string) {
+	w.Header().Set("Content-Type", value)
+}
+
+// writeBody writes the Content-Type and the encoded data, unless the
+// encoding failed
+func writeBody(w http.ResponseWriter, contentType string, data []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	writeContentType(w, contentType)
+	_, err = w.Write(data)
+	return err
+}
+
+// String renders a formatted text
+type String struct {
+	Format string
+	Data   []interface{}
+}
+
+func (r String) Render(w http.ResponseWriter) error {
+	return writeBody(w, MIMEPlain, []byte(fmt.Sprintf(r.Format, r.Data...)), nil)
+}
+
+func (r String) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEPlain)
+}
+
+// Data renders raw bytes, the Content-Type is not set when empty
+type Data struct {
+	ContentType string
+	Data        []byte
+}
+
+func (r Data) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	_, err := w.Write(r.Data)
+	return err
+}
+
+func (r Data) WriteContentType(w http.ResponseWriter) {
+	if r.ContentType != "" {
+		writeContentType(w, r.ContentType)
+	}
+}
+
+// HTML renders a template, the output is buffered so that a template
+// error does not leave a partial page behind
+type HTML struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+func (r HTML) Render(w http.ResponseWriter) error {
+	if r.Template == nil {
+		return fmt.Errorf("gee: no template loaded for %q", r.Name)
+	}
+	var buf bytes.Buffer
+	err := r.Template.ExecuteTemplate(&buf, r.Name, r.Data)
+	return writeBody(w, MIMEHTML, buf.Bytes(), err)
+}
+
+func (r HTML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEHTML)
+}
+
+// JSON renders Data as JSON
+type JSON struct {
+	Data interface{}
+}
+
+func (r JSON) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	return writeBody(w, MIMEJSON, data, err)
+}
+
+func (r JSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// IndentedJSON renders Data as pretty-printed JSON
+type IndentedJSON struct {
+	Data interface{}
+}
+
+func (r IndentedJSON) Render(w http.ResponseWriter) error {
+	data, err := json.MarshalIndent(r.Data, "", "    ")
+	return writeBody(w, MIMEJSON, data, err)
+}
+
+func (r IndentedJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// SecureJSON renders Data as JSON, arrays are prefixed with Prefix
+// to prevent JSON hijacking
+type SecureJSON struct {
+	Prefix string
+	Data   interface{}
+}
+
+func (r SecureJSON) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err == nil && bytes.HasPrefix(data, []byte("[")) {
+		data = append([]byte(r.Prefix), data...)
+	}
+	return writeBody(w, MIMEJSON, data, err)
+}
+
+func (r SecureJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// AsciiJSON renders Data as JSON with non-ASCII characters escaped as \uXXXX
+type AsciiJSON struct {
+	Data interface{}
+}
+
+func (r AsciiJSON) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, r := range string(data) {
+		if r < utf8.RuneSelf {
+			buf.WriteByte(byte(r))
+			continue
+		}
+		r1, r2 := utf16.EncodeRune(r)
+		if r1 == utf8.RuneError {
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		} else {
+			fmt.Fprintf(&buf, "\\u%04x\\u%04x", r1, r2)
+		}
+	}
+	return writeBody(w, MIMEJSON, buf.Bytes(), nil)
+}
+
+func (r AsciiJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// PureJSON renders Data as JSON without escaping <, > and &
+type PureJSON struct {
+	Data interface{}
+}
+
+func (r PureJSON) Render(w http.ResponseWriter) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(r.Data)
+	return writeBody(w, MIMEJSON, bytes.TrimSuffix(buf.Bytes(), []byte("\n")), err)
+}
+
+func (r PureJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEJSON)
+}
+
+// JSONP renders Data as JSON wrapped in a call of Callback, which must
+// be validated by the caller
+type JSONP struct {
+	Callback string
+	Data     interface{}
+}
+
+func (r JSONP) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, "application/javascript", []byte("/**/ "+r.Callback+"("+string(data)+");"), nil)
+}
+
+func (r JSONP) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, "application/javascript")
+}
+
+// XML renders Data as XML, H is rendered as a <map> element
+type XML struct {
+	Data interface{}
+}
+
+func (r XML) Render(w http.ResponseWriter) error {
+	data, err := xml.Marshal(r.Data)
+	return writeBody(w, MIMEXML, data, err)
+}
+
+func (r XML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEXML)
+}
+
+// MarshalXML encodes h as <key>value</key> elements, keys sorted, in the
+// element named by the parent, e.g. the key of a nested H. At the top
+// level, where encoding/xml names the element after the type, it is
+// named <map>. Keys that are not XML names are an error.
+func (h H) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if start.Name.Local == "" || start.Name.Local == "H" {
+		start.Name = xml.Name{Local: "map"}
+	}
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		if !isXMLName(key) {
+			return fmt.Errorf("gee: %q is not a valid XML element name", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		elem := xml.StartElement{Name: xml.Name{Local: key}}
+		if err := e.EncodeElement(h[key], elem); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(xml.EndElement{Name: start.Name})
+}
+
+// isXMLName reports whether name is a valid element name without
+// namespace prefix: a letter or '_', then letters, digits, '-', '.' or '_'
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// YAML renders Data as a YAML document
+type YAML struct {
+	Data interface{}
+}
+
+func (r YAML) Render(w http.ResponseWriter) error {
+	data, err := marshalYAML(r.Data)
+	return writeBody(w, MIMEYAML+"; charset=utf-8", data, err)
+}
+
+func (r YAML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEYAML+"; charset=utf-8")
+}
+
+// MsgPack renders Data in the MessagePack format
+type MsgPack struct {
+	Data interface{}
+}
+
+func (r MsgPack) Render(w http.ResponseWriter) error {
+	data, err := marshalMsgPack(r.Data)
+	return writeBody(w, MIMEMsgPack, data, err)
+}
+
+func (r MsgPack) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, MIMEMsgPack)
+}
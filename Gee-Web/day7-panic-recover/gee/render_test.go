@@ -0,0 +1,193 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type renderUser struct {
+	Name    string            `yaml:"name" msgpack:"name"`
+	Age     int               `yaml:"age,omitempty" msgpack:"age,omitempty"`
+	Tags    []string          `yaml:"tags" msgpack:"tags"`
+	Labels  map[string]string `yaml:"labels" msgpack:"-"`
+	Friends []renderUser      `yaml:"friends,omitempty" msgpack:"-"`
+}
+
+func TestRenderFormats(t *testing.T) {
+	r := New()
+	r.GET("/xml", func(c *Context) { c.XML(http.StatusOK, H{"name": "gee", "age": 1}) })
+	r.GET("/yaml", func(c *Context) {
+		c.YAML(http.StatusOK, renderUser{
+			Name:    "gee",
+			Tags:    []string{"web", "true"},
+			Labels:  map[string]string{"b": "x: y", "a": ""},
+			Friends: []renderUser{{Name: "tutu", Age: 3}},
+		})
+	})
+	r.GET("/msgpack", func(c *Context) { c.MsgPack(http.StatusOK, renderUser{Name: "gee", Tags: []string{"a"}}) })
+	r.GET("/nocontent", func(c *Context) { c.JSON(http.StatusNoContent, H{"a": 1}) })
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/xml", MIMEXML, "<map><age>1</age><name>gee</name></map>"},
+		{"/yaml", MIMEYAML + "; charset=utf-8", `name: gee
+tags:
+  - web
+  - "true"
+labels:
+  a: ""
+  b: "x: y"
+friends:
+  - name: tutu
+    age: 3
+    tags: []
+    labels: {}
+`},
+		{"/msgpack", MIMEMsgPack, "\x82\xa4name\xa3gee\xa4tags\x91\xa1a"},
+		{"/nocontent", MIMEJSON, ""},
+	}
+	for _, tt := range tests {
+		w := performRequest(r, "GET", tt.path)
+		if w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Fatalf("%s: got %q %q", tt.path, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestMarshalMsgPack(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{-1, []byte{0xff}},
+		{-33, []byte{0xd0, 0xdf}},
+		{200, []byte{0xcc, 0xc8}},
+		{70000, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{[]byte{1, 2}, []byte{0xc4, 2, 1, 2}},
+		{time.Unix(1, 0), []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}},
+	}
+	for _, tt := range tests {
+		got, err := marshalMsgPack(tt.v)
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Fatalf("%v: got % x, %v, want % x", tt.v, got, err, tt.want)
+		}
+	}
+	if _, err := marshalMsgPack(make(chan int)); err == nil {
+		t.Fatal("a channel should not be encoded")
+	}
+}
+
+type csvRender struct {
+	rows [][]string
+}
+
+func (r csvRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	for _, row := range r.rows {
+		w.Write([]byte(row[0] + "," + row[1] + "\n"))
+	}
+	return nil
+}
+
+func (r csvRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/csv")
+}
+
+func TestRegisterRender(t *testing.T) {
+	RegisterRender("text/csv", func(obj interface{}) Render {
+		return csvRender{rows: obj.([][]string)}
+	})
+	r := New()
+	r.GET("/csv", func(c *Context) {
+		c.RenderFormat(http.StatusOK, "text/csv", [][]string{{"a", "1"}, {"b", "2"}})
+	})
+	r.GET("/unknown", func(c *Context) {
+		c.RenderFormat(http.StatusOK, "application/x-unknown", nil)
+	})
+	if w := performRequest(r, "GET", "/csv"); w.Header().Get("Content-Type") != "text/csv" || w.Body.String() != "a,1\nb,2\n" {
+		t.Fatalf("unexpected response %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if w := performRequest(r, "GET", "/unknown"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("unknown format should be 500, got %d", w.Code)
+	}
+}
+
+func TestYAMLStringQuoting(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"gee", "gee"},
+		{"hello world", "hello world"},
+		{"a1", "a1"},
+		{"", `""`},
+		{"true", `"true"`},
+		{"No", `"No"`},
+		{"~", `"~"`},
+		{"null", `"null"`},
+		{"12", `"12"`},
+		{"1.5", `"1.5"`},
+		{"1e3", `"1e3"`},
+		{"0x1F", `"0x1F"`},
+		{"0o17", `"0o17"`},
+		{"0b101", `"0b101"`},
+		{"1_000", `"1_000"`},
+		{"2001-12-14", `"2001-12-14"`},
+		{"2001-12-14t21:59:43.10-05:00", `"2001-12-14t21:59:43.10-05:00"`},
+		{"1:20", `"1:20"`},
+		{"+12", `"+12"`},
+		{"-12", `"-12"`},
+		{".5", `".5"`},
+		{".inf", `".inf"`},
+		{"-.inf", `"-.inf"`},
+		{".NaN", `".NaN"`},
+		{"<<", `"<<"`},
+		{"=", `"="`},
+		{"a: b", `"a: b"`},
+		{"a #b", `"a #b"`},
+		{"line\nbreak", `"line\nbreak"`},
+	}
+	for _, tt := range tests {
+		if got := yamlString(tt.in); got != tt.want {
+			t.Fatalf("yamlString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+type xmlEnvelope struct {
+	XMLName xml.Name `xml:"envelope"`
+	Body    H        `xml:"body"`
+}
+
+func TestXMLOfH(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{H{"user": H{"name": "a"}}, "<map><user><name>a</name></user></map>"},
+		{H{"b": 2, "a": H{"c": H{}}}, "<map><a><c></c></a><b>2</b></map>"},
+		{xmlEnvelope{Body: H{"id": 7}}, "<envelope><body><id>7</id></body></envelope>"},
+	}
+	for _, tt := range tests {
+		got, err := xml.Marshal(tt.v)
+		if err != nil || string(got) != tt.want {
+			t.Fatalf("got %s, %v, want %s", got, err, tt.want)
+		}
+	}
+
+	for _, key := range []string{"bad key", "1id", "", "a<b"} {
+		if _, err := xml.Marshal(H{"ok": H{key: 1}}); err == nil {
+			t.Fatalf("%q should be rejected as an element name", key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gee
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriterTracksStatusAndSize(t *testing.T) {
+	r := New()
+	var status, legacyStatus, size int
+	r.Use(func(c *Context) {
+		c.Next()
+		status, legacyStatus, size = c.Writer.Status(), c.StatusCode, c.Writer.Size()
+	})
+	r.GET("/raw", func(c *Context) {
+		c.Writer.Write([]byte("hello"))
+	})
+	r.GET("/twice", func(c *Context) {
+		c.JSON(http.StatusOK, H{"ok": true})
+		c.Fail(http.StatusInternalServerError, "late failure")
+	})
+	r.GET("/status", func(c *Context) {
+		c.Status(http.StatusCreated)
+		c.Status(http.StatusAccepted)
+	})
+	r.GET("/direct", func(c *Context) {
+		c.Writer.WriteHeader(http.StatusNotFound)
+	})
+
+	if w := performRequest(r, "GET", "/raw"); w.Code != http.StatusOK || status != http.StatusOK || size != 5 {
+		t.Fatalf("raw write should be tracked as 200/5, got %d/%d", status, size)
+	}
+	if w := performRequest(r, "GET", "/twice"); w.Code != http.StatusOK || status != http.StatusOK {
+		t.Fatalf("the first status should win, got %d/%d", w.Code, status)
+	}
+	if w := performRequest(r, "GET", "/status"); w.Code != http.StatusAccepted || status != http.StatusAccepted {
+		t.Fatalf("status should be written once the handlers return, got %d/%d", w.Code, status)
+	}
+	if w := performRequest(r, "GET", "/direct"); w.Code != http.StatusNotFound || legacyStatus != http.StatusNotFound {
+		t.Fatalf("StatusCode should follow the writer, got %d/%d", w.Code, legacyStatus)
+	}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	var w responseWriter
+	rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w.reset(rec)
+	if w.Written() || w.Size() != noWritten || w.Status() != http.StatusOK {
+		t.Fatal("a fresh writer should not be written")
+	}
+
+	w.WriteHeader(http.StatusTeapot)
+	w.Flush()
+	if !rec.Flushed || rec.Code != http.StatusTeapot || !w.Written() {
+		t.Fatal("Flush should write the header and flush the original writer")
+	}
+	if _, _, err := w.Hijack(); err != nil || !rec.hijacked {
+		t.Fatal("Hijack should reach the original writer")
+	}
+	if err := w.Push("/style.css", nil); err != http.ErrNotSupported {
+		t.Fatalf("Push should report ErrNotSupported, got %v", err)
+	}
+	if http.NewResponseController(&w) == nil || w.Unwrap() != rec {
+		t.Fatal("Unwrap should return the original writer")
+	}
+
+	w.reset(httptest.NewRecorder())
+	if _, _, err := w.Hijack(); err == nil {
+		t.Fatal("Hijack should fail when the original writer is not a Hijacker")
+	}
+}
@@ -1,20 +1,101 @@
 package gee
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 )
 
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	roots     map[string]*node
+	maxParams int // the most wildcards of a single route
+	// chains for requests without a route, global middleware included
+	notFound         []HandlerFunc
+	methodNotAllowed []HandlerFunc
+	options          []HandlerFunc
 }
 
 func newRouter() *router {
-	return &router{
-		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+	r := &router{
+		roots: make(map[string]*node),
 	}
+	r.rebuild(nil)
+	return r
+}
+
+// route is what a pattern resolves to. Its chain, the middleware of the
+// group and of its ancestors followed by the handlers, is computed when the
+// route is registered and again whenever middleware is added, so serving a
+// request needs no middleware lookup.
+type route struct {
+	group    *RouterGroup
+	handlers []HandlerFunc // route-level middleware and the handler
+	chain    []HandlerFunc
+}
+
+func newRoute(group *RouterGroup, handlers []HandlerFunc) *route {
+	rt := &route{group: group, handlers: handlers}
+	rt.build()
+	return rt
+}
+
+func (rt *route) build() {
+	if rt.group == nil {
+		rt.chain = combineHandlers(nil, rt.handlers...)
+		return
+	}
+	rt.chain = rt.group.combineHandlers(rt.handlers...)
+}
+
+// rebuild recomputes the chain of every route, global is the middleware
+// of the engine that also runs for requests without a route
+func (r *router) rebuild(global []HandlerFunc) {
+	for _, root := range r.roots {
+		nodes := make([]*node, 0)
+		root.travel(&nodes)
+		for _, n := range nodes {
+			if n.route != nil {
+				n.route.build()
+			}
+		}
+	}
+	r.notFound = combineHandlers(global, serveNotFound)
+	r.methodNotAllowed = combineHandlers(global, serveMethodNotAllowed)
+	r.options = combineHandlers(global, serveOptions)
+}
+
+func combineHandlers(middlewares []HandlerFunc, handlers ...HandlerFunc) []HandlerFunc {
+	merged := make([]HandlerFunc, 0, len(middlewares)+len(handlers))
+	merged = append(merged, middlewares...)
+	return append(merged, handlers...)
+}
+
+// Param is a single URL parameter, consisting of a key and a value
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params is the list of URL parameters matched by a route, in the order
+// of the pattern. It is a slice so that it can be reused across requests.
+type Params []Param
+
+// Get returns the value of the first Param with the given key
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName returns the value of the first Param with the given key,
+// or an empty string
+func (ps Params) ByName(key string) string {
+	value, _ := ps.Get(key)
+	return value
 }
 
 // Only one * is allowed
@@ -33,44 +114,68 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
+// addRoute registers the handler, it fails if the route is already
+// registered or conflicts with an existing one of the same method
+func (r *router) addRoute(method string, pattern string, rt *route) error {
 	parts := parsePattern(pattern)
 
-	key := method + "-" + pattern
-	_, ok := r.roots[method]
+	root, ok := r.roots[method]
 	if !ok {
-		r.roots[method] = &node{}
+		root = &node{}
+		r.roots[method] = root
+	}
+	if err := root.insert("/"+strings.Join(parts, "/"), pattern, rt); err != nil {
+		return fmt.Errorf("gee: %s %w", method, err)
+	}
+	params := 0
+	for _, part := range parts {
+		if part[0] == ':' || part[0] == '*' {
+			params++
+		}
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	if params > r.maxParams {
+		r.maxParams = params
+	}
+	return nil
 }
 
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchParts := parsePattern(path)
-	params := make(map[string]string)
+// findRoute returns the route matching path and appends its parameters
+// to ps. It does not allocate when ps has enough capacity.
+func (r *router) findRoute(method string, path string, ps *Params) *node {
 	root, ok := r.roots[method]
-
 	if !ok {
-		return nil, nil
+		return nil
 	}
+	// "/v1//hello" matches "/v1/hello", the empty segments are ignored
+	if strings.Contains(path, "//") {
+		path = collapseSlashes(path)
+	}
+	// "/hello/" matches "/hello"
+	for len(path) > 1 && path[len(path)-1] == '/' {
+		path = path[:len(path)-1]
+	}
+	return root.search(path, ps)
+}
 
-	n := root.search(searchParts, 0)
-
-	if n != nil {
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
-			}
+// collapseSlashes replaces the runs of '/' in path by a single one
+func collapseSlashes(path string) string {
+	b := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && len(b) > 0 && b[len(b)-1] == '/' {
+			continue
 		}
-		return n, params
+		b = append(b, path[i])
 	}
+	return string(b)
+}
 
-	return nil, nil
+func (r *router) getRoute(method string, path string) (*node, Params) {
+	params := make(Params, 0)
+	n := r.findRoute(method, path, &params)
+	if n == nil {
+		return nil, nil
+	}
+	return n, params
 }
 
 func (r *router) getRoutes(method string) []*node {
@@ -83,17 +188,104 @@ func (r *router) getRoutes(method string) []*node {
 	return nodes
 }
 
+// allowed returns the methods, other than reqMethod, that have a route
+// matching path, formatted for the Allow header. The path "*" matches every
+// registered method. autoHead and autoOptions add the methods the engine
+// answers on its own.
+func (r *router) allowed(path string, reqMethod string, autoHead, autoOptions bool) string {
+	methods := make([]string, 0)
+	for method := range r.roots {
+		if method == reqMethod {
+			continue
+		}
+		if path == "*" {
+			methods = append(methods, method)
+		} else if n, _ := r.getRoute(method, path); n != nil {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	if autoHead && reqMethod != http.MethodHead && contains(methods, http.MethodGet) && !contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if autoOptions && !contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// bodylessResponseWriter drops the body, it answers HEAD with the GET handler
+type bodylessResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w bodylessResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func serveNotFound(c *Context) {
+	c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
+}
+
+func serveMethodNotAllowed(c *Context) {
+	c.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED: %s\n", c.Path)
+}
+
+func serveOptions(c *Context) {
+	c.Status(http.StatusNoContent)
+}
+
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	engine := c.engine
+	if n := r.findRoute(c.Method, c.Path, &c.Params); n != nil {
+		c.fullPath = n.pattern
+		c.handlers = n.route.chain
+		c.Next()
+		return
+	}
 
-	if n != nil {
-		key := c.Method + "-" + n.pattern
-		c.Params = params
-		c.handlers = append(c.handlers, r.handlers[key])
-	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
-		})
+	// HEAD falls back to GET with the body thrown away
+	if c.Method == http.MethodHead && engine.HandleHEAD {
+		if n := r.findRoute(http.MethodGet, c.Path, &c.Params); n != nil {
+			c.writermem.ResponseWriter = bodylessResponseWriter{c.writermem.ResponseWriter}
+			c.fullPath = n.pattern
+			c.handlers = n.route.chain
+			c.Next()
+			return
+		}
+	}
+
+	// OPTIONS is answered from the route table
+	if c.Method == http.MethodOptions && engine.HandleOPTIONS {
+		if allow := r.allowed(c.Path, c.Method, engine.HandleHEAD, true); allow != "" {
+			c.SetHeader("Allow", allow)
+			c.handlers = r.options
+			c.Next()
+			return
+		}
 	}
+
+	if engine.HandleMethodNotAllowed {
+		if allow := r.allowed(c.Path, c.Method, engine.HandleHEAD, engine.HandleOPTIONS); allow != "" {
+			c.SetHeader("Allow", allow)
+			c.handlers = r.methodNotAllowed
+			c.Next()
+			return
+		}
+	}
+
+	c.handlers = r.notFound
 	c.Next()
 }
@@ -3,6 +3,7 @@ package gee
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -37,30 +38,53 @@ func TestGetRoute(t *testing.T) {
 		t.Fatal("should match /hello/:name")
 	}
 
-	if ps["name"] != "geektutu" {
+	if ps.ByName("name") != "geektutu" {
 		t.Fatal("name should be equal to 'geektutu'")
 	}
 
-	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
+	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps.ByName("name"))
 
 }
 
 func TestGetRoute2(t *testing.T) {
 	r := newTestRouter()
 	n1, ps1 := r.getRoute("GET", "/assets/file1.txt")
-	ok1 := n1.pattern == "/assets/*filepath" && ps1["filepath"] == "file1.txt"
+	ok1 := n1.pattern == "/assets/*filepath" && ps1.ByName("filepath") == "file1.txt"
 	if !ok1 {
 		t.Fatal("pattern shoule be /assets/*filepath & filepath shoule be file1.txt")
 	}
 
 	n2, ps2 := r.getRoute("GET", "/assets/css/test.css")
-	ok2 := n2.pattern == "/assets/*filepath" && ps2["filepath"] == "css/test.css"
+	ok2 := n2.pattern == "/assets/*filepath" && ps2.ByName("filepath") == "css/test.css"
 	if !ok2 {
 		t.Fatal("pattern shoule be /assets/*filepath & filepath shoule be css/test.css")
 	}
 
 }
 
+func TestGetRouteRepeatedSlashes(t *testing.T) {
+	r := newTestRouter()
+	tests := []struct {
+		path    string
+		pattern string
+		param   string
+	}{
+		{"//hello//geektutu", "/hello/:name", "geektutu"},
+		{"/hello//b///c/", "/hello/b/c", ""},
+		{"/assets//css//test.css", "/assets/*filepath", "css/test.css"},
+		{"//", "/", ""},
+	}
+	for _, tt := range tests {
+		n, ps := r.getRoute("GET", tt.path)
+		if n == nil || n.pattern != tt.pattern {
+			t.Fatalf("%s should match %s, got %v", tt.path, tt.pattern, n)
+		}
+		if len(ps) > 0 && ps[0].Value != tt.param {
+			t.Fatalf("%s: unexpected parameter %q", tt.path, ps[0].Value)
+		}
+	}
+}
+
 func TestGetRoutes(t *testing.T) {
 	r := newTestRouter()
 	nodes := r.getRoutes("GET")
@@ -72,3 +96,191 @@ func TestGetRoutes(t *testing.T) {
 		t.Fatal("the number of routes shoule be 4")
 	}
 }
+
+func TestAddRouteConflict(t *testing.T) {
+	tests := []struct {
+		existing string
+		pattern  string
+	}{
+		{"/hello/:name", "/hello/:id"},
+		{"/hello/:name/profile", "/hello/:id"},
+		{"/assets/*filepath", "/assets/:x"},
+		{"/assets/:x", "/assets/*filepath"},
+		{"/assets/*filepath", "/assets/*path"},
+		{"/hello/:name", "/hello/:name"},
+		{"/hello/", "/hello"},
+	}
+	for _, tt := range tests {
+		r := newRouter()
+		if err := r.addRoute("GET", tt.existing, nil); err != nil {
+			t.Fatalf("add %s: %v", tt.existing, err)
+		}
+		err := r.addRoute("GET", tt.pattern, nil)
+		if err == nil {
+			t.Fatalf("%s should conflict with %s", tt.pattern, tt.existing)
+		}
+		if !strings.Contains(err.Error(), tt.pattern) || !strings.Contains(err.Error(), tt.existing) {
+			t.Fatalf("error should name both patterns, got %q", err)
+		}
+		if err := r.addRoute("POST", tt.pattern, nil); err != nil {
+			t.Fatalf("%s should not conflict across methods: %v", tt.pattern, err)
+		}
+	}
+}
+
+func TestAddRouteNoConflict(t *testing.T) {
+	r := newRouter()
+	for _, pattern := range []string{"/hello/:name", "/hello/b", "/hello/:name/c", "/assets/*filepath", "/assets/logo.png"} {
+		if err := r.addRoute("GET", pattern, nil); err != nil {
+			t.Fatalf("add %s: %v", pattern, err)
+		}
+	}
+}
+
+func TestRouterGroupConflictPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a conflicting route should panic")
+		}
+	}()
+	r := New()
+	r.GET("/hello/:name", func(c *Context) {})
+	r.Group("/hello").GET("/:id", func(c *Context) {})
+}
+
+func paramsMap(ps Params) map[string]string {
+	m := make(map[string]string)
+	for _, p := range ps {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+func TestRoutePriority(t *testing.T) {
+	patterns := []string{
+		"/hello/:name",
+		"/hello/b/c",
+		"/hello/:name/d",
+		"/static/*filepath",
+		"/static/css/site.css",
+		"/static/js/:file",
+	}
+	tests := []struct {
+		path    string
+		pattern string
+		params  map[string]string
+	}{
+		{"/hello/geektutu", "/hello/:name", map[string]string{"name": "geektutu"}},
+		{"/hello/b/c", "/hello/b/c", map[string]string{}},
+		{"/hello/x/d", "/hello/:name/d", map[string]string{"name": "x"}},
+		// the static b subtree has no match, so search backtracks to :name
+		{"/hello/b", "/hello/:name", map[string]string{"name": "b"}},
+		{"/hello/b/d", "/hello/:name/d", map[string]string{"name": "b"}},
+		{"/hello/b/e", "", nil},
+		{"/static/css/site.css", "/static/css/site.css", map[string]string{}},
+		{"/static/js/app.js", "/static/js/:file", map[string]string{"file": "app.js"}},
+		// static and param subtrees miss, the catch-all takes over
+		{"/static/css/other.css", "/static/*filepath", map[string]string{"filepath": "css/other.css"}},
+		{"/static/js/lib/app.js", "/static/*filepath", map[string]string{"filepath": "js/lib/app.js"}},
+		{"/static/img/logo.png", "/static/*filepath", map[string]string{"filepath": "img/logo.png"}},
+	}
+
+	check := func(name string, r *router) {
+		for _, tt := range tests {
+			n, ps := r.getRoute("GET", tt.path)
+			if tt.pattern == "" {
+				if n != nil {
+					t.Fatalf("%s: %s should not match, got %s", name, tt.path, n.pattern)
+				}
+				continue
+			}
+			if n == nil {
+				t.Fatalf("%s: %s should match %s", name, tt.path, tt.pattern)
+			}
+			if n.pattern != tt.pattern || !reflect.DeepEqual(paramsMap(ps), tt.params) {
+				t.Fatalf("%s: %s matched %s %v, want %s %v", name, tt.path, n.pattern, ps, tt.pattern, tt.params)
+			}
+		}
+	}
+
+	// every rotation of the registration order must give the same result
+	for shift := 0; shift < len(patterns); shift++ {
+		r := newRouter()
+		for i := range patterns {
+			pattern := patterns[(i+shift)%len(patterns)]
+			if err := r.addRoute("GET", pattern, nil); err != nil {
+				t.Fatalf("add %s: %v", pattern, err)
+			}
+		}
+		check(fmt.Sprintf("shift %d", shift), r)
+	}
+
+	r := newRouter()
+	for i := len(patterns) - 1; i >= 0; i-- {
+		r.addRoute("GET", patterns[i], nil)
+	}
+	check("reversed", r)
+}
+
+func TestRadixTreeSplit(t *testing.T) {
+	r := newRouter()
+	patterns := []string{"/search", "/support", "/src/*filepath", "/s", "/su/:id", "/search/:query/page/:page", "/"}
+	for _, pattern := range patterns {
+		if err := r.addRoute("GET", pattern, nil); err != nil {
+			t.Fatalf("add %s: %v", pattern, err)
+		}
+	}
+	tests := []struct {
+		path    string
+		pattern string
+		params  string
+	}{
+		{"/", "/", ""},
+		{"/s", "/s", ""},
+		{"/search", "/search", ""},
+		{"/search/", "/search", ""},
+		{"/support", "/support", ""},
+		{"/su/42", "/su/:id", "id=42"},
+		{"/src/gee/trie.go", "/src/*filepath", "filepath=gee/trie.go"},
+		{"/search/gee/page/2", "/search/:query/page/:page", "query=gee page=2"},
+		{"/sea", "", ""},
+		{"/supports", "", ""},
+		{"/src", "", ""},
+	}
+	for _, tt := range tests {
+		n, ps := r.getRoute("GET", tt.path)
+		if tt.pattern == "" {
+			if n != nil {
+				t.Fatalf("%s should not match, got %s", tt.path, n.pattern)
+			}
+			continue
+		}
+		if n == nil || n.pattern != tt.pattern {
+			t.Fatalf("%s should match %s, got %v", tt.path, tt.pattern, n)
+		}
+		got := make([]string, 0)
+		for _, p := range ps {
+			got = append(got, p.Key+"="+p.Value)
+		}
+		if strings.Join(got, " ") != tt.params {
+			t.Fatalf("%s: params should be %q, got %q", tt.path, tt.params, strings.Join(got, " "))
+		}
+	}
+	if nodes := r.getRoutes("GET"); len(nodes) != len(patterns) {
+		t.Fatalf("the number of routes should be %d, got %d", len(patterns), len(nodes))
+	}
+}
+
+func TestFindRouteZeroAllocation(t *testing.T) {
+	r := newTestRouter()
+	ps := make(Params, 0, 8)
+	allocs := testing.AllocsPerRun(100, func() {
+		ps = ps[:0]
+		r.findRoute("GET", "/hello/geektutu", &ps)
+		ps = ps[:0]
+		r.findRoute("GET", "/assets/css/test.css", &ps)
+	})
+	if allocs != 0 {
+		t.Fatalf("findRoute should not allocate, got %v allocs", allocs)
+	}
+}
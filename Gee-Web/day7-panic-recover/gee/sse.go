@@ -0,0 +1,97 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MIMEEventStream is the Content-Type of Server-Sent Events
+const MIMEEventStream = "text/event-stream"
+
+// SSEvent renders a Server-Sent Event. Data is written as is when it is
+// a string or a []byte, and as JSON otherwise. Every line of Data gets
+// its own "data:" field, Retry is the reconnection time in milliseconds.
+type SSEvent struct {
+	Event string
+	ID    string
+	Retry uint
+	Data  interface{}
+}
+
+func (r SSEvent) Render(w http.ResponseWriter) error {
+	var data []byte
+	switch d := r.Data.(type) {
+	case string:
+		data = []byte(d)
+	case []byte:
+		data = d
+	default:
+		var err error
+		if data, err = json.Marshal(d); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if r.ID != "" {
+		buf.WriteString("id: " + sseField(r.ID) + "\n")
+	}
+	if r.Event != "" {
+		buf.WriteString("event: " + sseField(r.Event) + "\n")
+	}
+	if r.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatUint(uint64(r.Retry), 10) + "\n")
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	r.WriteContentType(w)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (r SSEvent) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("Content-Type", MIMEEventStream)
+	header.Set("Cache-Control", "no-cache")
+}
+
+// sseField removes the line breaks that would end a field early
+func sseField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SSEvent writes a Server-Sent Event named name, see the SSEvent
+// renderer for id and retry
+func (c *Context) SSEvent(name string, data interface{}) {
+	c.Render(-1, SSEvent{Event: name, Data: data})
+}
+
+// Stream calls step and flushes the response until step returns false
+// or the client goes away, which is detected through the request
+// context. It reports whether the client went away.
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	done := c.Req.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+			keepOpen := step(c.Writer)
+			c.Writer.Flush()
+			if !keepOpen {
+				return false
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package gee
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEventRender(t *testing.T) {
+	tests := []struct {
+		event SSEvent
+		want  string
+	}{
+		{SSEvent{Event: "message", Data: "hello"}, "event: message\ndata: hello\n\n"},
+		{SSEvent{ID: "7\n", Retry: 3000, Data: "a\r\nb\nc"}, "id: 7\nretry: 3000\ndata: a\ndata: b\ndata: c\n\n"},
+		{SSEvent{Event: "user", Data: H{"name": "gee"}}, "event: user\ndata: {\"name\":\"gee\"}\n\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		if err := tt.event.Render(w); err != nil || w.Body.String() != tt.want {
+			t.Fatalf("got %q, %v, want %q", w.Body.String(), err, tt.want)
+		}
+		if w.Header().Get("Content-Type") != MIMEEventStream || w.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("unexpected headers %v", w.Header())
+		}
+	}
+}
+
+func TestContextStream(t *testing.T) {
+	r := New()
+	r.GET("/count", func(c *Context) {
+		n := 0
+		c.Stream(func(w io.Writer) bool {
+			n++
+			c.SSEvent("count", n)
+			return n < 3
+		})
+	})
+	w := performRequest(r, "GET", "/count")
+	want := "event: count\ndata: 1\n\nevent: count\ndata: 2\n\nevent: count\ndata: 3\n\n"
+	if w.Code != http.StatusOK || !w.Flushed || w.Body.String() != want {
+		t.Fatalf("unexpected stream %d %t %q", w.Code, w.Flushed, w.Body.String())
+	}
+
+	// the stream stops once the client is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	var steps int
+	var gone bool
+	r.GET("/forever", func(c *Context) {
+		gone = c.Stream(func(w io.Writer) bool {
+			steps++
+			if steps == 2 {
+				cancel()
+			}
+			return true
+		})
+	})
+	req := httptest.NewRequest("GET", "/forever", nil).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if !gone || steps != 2 {
+		t.Fatalf("the stream should stop after the client is gone, got %t after %d steps", gone, steps)
+	}
+}
@@ -5,48 +5,183 @@ import (
 	"strings"
 )
 
+type nodeType uint8
+
+const (
+	static   nodeType = iota // "/hello/"
+	param                    // ":name"
+	catchAll                 // "*filepath"
+)
+
+// node is a node of a compressed radix tree. Static children share their
+// common prefixes, a node has at most one :param and one *catchall child,
+// and only one of the two. Routes end at the node storing their pattern.
 type node struct {
-	pattern  string
-	part     string
-	children []*node
-	isWild   bool
+	path       string // static prefix, or the wildcard with its name
+	nType      nodeType
+	pattern    string  // the registered pattern of the route ending here
+	route      *route  // the route ending here
+	indices    string  // first byte of each static child
+	children   []*node // static children
+	paramChild *node
+	wildChild  *node // catch-all child
 }
 
 func (n *node) String() string {
-	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
+	return fmt.Sprintf("node{pattern=%s, path=%s, isWild=%t}", n.pattern, n.path, n.nType != static)
 }
 
-func (n *node) insert(pattern string, parts []string, height int) {
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+// insert adds the route to the tree. path is the cleaned pattern, every
+// wildcard starts right after a '/'. It fails when the route is already
+// registered, or when one of its wildcards would share a position with
+// a differently named or differently typed wildcard.
+func (n *node) insert(path string, pattern string, rt *route) error {
+	for path != "" {
+		switch path[0] {
+		case ':':
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			wild := path[:end]
+			if n.wildChild != nil {
+				return conflictError(pattern, n.wildChild.firstPattern())
+			}
+			if n.paramChild == nil {
+				n.paramChild = &node{path: wild, nType: param}
+			} else if n.paramChild.path != wild {
+				return conflictError(pattern, n.paramChild.firstPattern())
+			}
+			n, path = n.paramChild, path[end:]
+		case '*':
+			if n.paramChild != nil {
+				return conflictError(pattern, n.paramChild.firstPattern())
+			}
+			if n.wildChild == nil {
+				n.wildChild = &node{path: path, nType: catchAll}
+			} else if n.wildChild.path != path {
+				return conflictError(pattern, n.wildChild.firstPattern())
+			}
+			n, path = n.wildChild, ""
+		default:
+			end := wildcardIndex(path)
+			n, path = n.insertStatic(path[:end]), path[end:]
+		}
 	}
 
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		n.children = append(n.children, child)
+	if n.pattern != "" {
+		return conflictError(pattern, n.pattern)
 	}
-	child.insert(pattern, parts, height+1)
+	n.pattern = pattern
+	n.route = rt
+	return nil
 }
 
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+// insertStatic walks down the static children along prefix, splitting
+// edges where prefix diverges, and returns the node where prefix ends
+func (n *node) insertStatic(prefix string) *node {
+	for {
+		i := strings.IndexByte(n.indices, prefix[0])
+		if i < 0 {
+			child := &node{path: prefix}
+			n.indices += prefix[:1]
+			n.children = append(n.children, child)
+			return child
+		}
+
+		child := n.children[i]
+		l := commonPrefix(child.path, prefix)
+		if l < len(child.path) {
+			// move everything below the common prefix into a new node
+			split := *child
+			split.path = child.path[l:]
+			*child = node{
+				path:     child.path[:l],
+				indices:  split.path[:1],
+				children: []*node{&split},
+			}
+		}
+		if l == len(prefix) {
+			return child
+		}
+		n, prefix = child, prefix[l:]
+	}
+}
+
+// wildcardIndex returns the index of the first segment of path that
+// starts with ':' or '*', or len(path)
+func wildcardIndex(path string) int {
+	for i := 1; i < len(path); i++ {
+		if path[i-1] == '/' && (path[i] == ':' || path[i] == '*') {
+			return i
+		}
+	}
+	return len(path)
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func conflictError(pattern string, existing string) error {
+	return fmt.Errorf("route %s conflicts with existing route %s", pattern, existing)
+}
+
+// firstPattern returns a pattern registered in the subtree of n
+func (n *node) firstPattern() string {
+	nodes := make([]*node, 0)
+	n.travel(&nodes)
+	if len(nodes) == 0 {
+		return n.path
+	}
+	return nodes[0].pattern
+}
+
+// search matches path against the subtree of n, n itself being already
+// consumed. Static children are tried first, then the :param child, then
+// the *catchall child, backtracking to the next candidate when a subtree
+// has no match. Wildcard values are appended to ps, which does not
+// allocate when ps has enough capacity.
+func (n *node) search(path string, ps *Params) *node {
+	if path == "" {
 		if n.pattern == "" {
 			return nil
 		}
 		return n
 	}
 
-	part := parts[height]
-	children := n.matchChildren(part)
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.path) {
+			if result := child.search(path[len(child.path):], ps); result != nil {
+				return result
+			}
+		}
+	}
+
+	if child := n.paramChild; child != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			*ps = append(*ps, Param{Key: child.path[1:], Value: path[:end]})
+			if result := child.search(path[end:], ps); result != nil {
+				return result
+			}
+			*ps = (*ps)[:len(*ps)-1]
+		}
+	}
 
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
-			return result
+	if child := n.wildChild; child != nil && child.pattern != "" {
+		if len(child.path) > 1 {
+			*ps = append(*ps, Param{Key: child.path[1:], Value: path})
 		}
+		return child
 	}
 
 	return nil
@@ -59,23 +194,10 @@ func (n *node) travel(list *([]*node)) {
 	for _, child := range n.children {
 		child.travel(list)
 	}
-}
-
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
-		}
+	if n.paramChild != nil {
+		n.paramChild.travel(list)
 	}
-	return nil
-}
-
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
-		}
+	if n.wildChild != nil {
+		n.wildChild.travel(list)
 	}
-	return nodes
 }
@@ -0,0 +1,114 @@
+package gee
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// parseForm parses the query and the urlencoded or multipart body once,
+// multipart files beyond engine.MaxMultipartMemory are stored on disk.
+// A body beyond engine.MaxUploadSize is answered with 413.
+func (c *Context) parseForm() error {
+	if c.Req.Form == nil {
+		c.limitBody()
+	}
+	if err := c.Req.ParseMultipartForm(c.engine.MaxMultipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return c.checkBodySize(err)
+	}
+	return nil
+}
+
+// limitBody caps the request body at engine.MaxUploadSize
+func (c *Context) limitBody() {
+	if max := c.engine.MaxUploadSize; max > 0 && c.Req.Body != nil {
+		c.Req.Body = http.MaxBytesReader(c.Writer, c.Req.Body, max)
+	}
+}
+
+// checkBodySize answers 413 when err comes from a body beyond
+// engine.MaxUploadSize, it returns err
+func (c *Context) checkBodySize(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) && !c.Writer.Written() {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, H{"message": "request body too large"})
+	}
+	return err
+}
+
+// MultipartForm returns the parsed multipart form, files included
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	if c.Req.MultipartForm == nil {
+		return nil, http.ErrNotMultipart
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile returns the first file uploaded under name
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if fhs := form.File[name]; len(fhs) > 0 {
+		return fhs[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// SaveUploadedFile copies an uploaded file to dst, the parent directories
+// of dst are created when missing
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// StreamMultipart hands the parts of a multipart body to fn one at a
+// time, as they are read from the connection, so that large files never
+// sit in memory or in a temporary file. A part is only readable until fn
+// returns, the first error of fn stops the stream and is returned.
+// The body cannot be read again, by MultipartForm or FormFile for instance.
+// A body beyond engine.MaxUploadSize stops the stream with 413.
+func (c *Context) StreamMultipart(fn func(part *multipart.Part) error) error {
+	c.limitBody()
+	reader, err := c.Req.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return c.checkBodySize(err)
+		}
+		err = fn(part)
+		part.Close()
+		if err != nil {
+			return c.checkBodySize(err)
+		}
+	}
+}
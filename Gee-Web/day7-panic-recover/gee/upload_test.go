@@ -0,0 +1,141 @@
+package gee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newUploadRequest(t *testing.T, fields map[string]string, files map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestFormFile(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "uploads", "data.csv")
+	r := New()
+	r.MaxMultipartMemory = 8 // the file is stored on disk
+	r.POST("/upload", func(c *Context) {
+		fh, err := c.FormFile("data")
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := c.FormFile("missing"); !errors.Is(err, http.ErrMissingFile) {
+			c.Fail(http.StatusInternalServerError, "missing file not reported")
+			return
+		}
+		if err := c.SaveUploadedFile(fh, dst); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s %d %s", fh.Filename, fh.Size, c.PostForm("name"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, map[string]string{"name": "gee"}, map[string]string{"data": "a,1\nb,2\n"}))
+	if w.Code != http.StatusOK || w.Body.String() != "data.csv 8 gee" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if content, err := os.ReadFile(dst); err != nil || string(content) != "a,1\nb,2\n" {
+		t.Fatalf("unexpected saved file %q, %v", content, err)
+	}
+
+	c := newBindContext("POST", "/upload", MIMEPOSTForm, "name=gee")
+	if _, err := c.MultipartForm(); !errors.Is(err, http.ErrNotMultipart) {
+		t.Fatalf("urlencoded form should not be multipart, got %v", err)
+	}
+}
+
+func TestStreamMultipart(t *testing.T) {
+	req := newUploadRequest(t, map[string]string{"name": "gee"}, map[string]string{"data": strings.Repeat("x", 1<<16)})
+	c := New().allocateContext()
+	c.reset(httptest.NewRecorder(), req)
+
+	var got []string
+	err := c.StreamMultipart(func(part *multipart.Part) error {
+		n, err := io.Copy(io.Discard, part)
+		got = append(got, fmt.Sprintf("%s:%s:%d", part.FormName(), part.FileName(), n))
+		return err
+	})
+	if err != nil || len(got) != 2 || got[0] != "name::3" || got[1] != "data:data.csv:65536" {
+		t.Fatalf("unexpected parts %q, %v", got, err)
+	}
+
+	stop := errors.New("stop")
+	req = newUploadRequest(t, map[string]string{"a": "1", "b": "2"}, nil)
+	c.reset(httptest.NewRecorder(), req)
+	calls := 0
+	if err := c.StreamMultipart(func(*multipart.Part) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Fatalf("the stream should stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	r := New()
+	r.MaxUploadSize = 1 << 10
+	r.POST("/file", func(c *Context) {
+		if _, err := c.FormFile("data"); err != nil {
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.POST("/bind", func(c *Context) {
+		var form struct {
+			Name string `form:"name"`
+		}
+		if err := c.Bind(&form); err != nil {
+			c.AbortWithBindError(err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.POST("/stream", func(c *Context) {
+		err := c.StreamMultipart(func(part *multipart.Part) error {
+			_, err := io.Copy(io.Discard, part)
+			return err
+		})
+		if err == nil {
+			c.String(http.StatusOK, "ok")
+		}
+	})
+
+	for _, path := range []string{"/file", "/bind", "/stream"} {
+		w := httptest.NewRecorder()
+		req := newUploadRequest(t, map[string]string{"name": "gee"}, map[string]string{"data": "small"})
+		req.URL.Path = path
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: a small body should be accepted, got %d %q", path, w.Code, w.Body.String())
+		}
+		w = httptest.NewRecorder()
+		req = newUploadRequest(t, map[string]string{"name": "gee"}, map[string]string{"data": strings.Repeat("x", 4<<10)})
+		req.URL.Path = path
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge || w.Body.String() != `{"message":"request body too large"}` {
+			t.Fatalf("%s: expected 413, got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
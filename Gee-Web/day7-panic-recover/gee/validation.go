@@ -0,0 +1,287 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidatorFunc reports whether field satisfies the rule, param is the
+// text after '=' in the tag, e.g. "64" for max=64. Pointers are already
+// dereferenced, nil pointers are only seen by required.
+type ValidatorFunc func(field reflect.Value, param string) bool
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]ValidatorFunc{
+		"min":   compareRule(func(n, p float64) bool { return n >= p }),
+		"max":   compareRule(func(n, p float64) bool { return n <= p }),
+		"len":   compareRule(func(n, p float64) bool { return n == p }),
+		"gt":    compareRule(func(n, p float64) bool { return n > p }),
+		"gte":   compareRule(func(n, p float64) bool { return n >= p }),
+		"lt":    compareRule(func(n, p float64) bool { return n < p }),
+		"lte":   compareRule(func(n, p float64) bool { return n <= p }),
+		"oneof": validateOneOf,
+		"email": validateEmail,
+		"url":   validateURL,
+	}
+)
+
+// RegisterValidation adds a rule usable in binding tags, it replaces the
+// built-in rule of the same name. required and omitempty are reserved.
+func RegisterValidation(name string, fn ValidatorFunc) {
+	if name == "" || name == "required" || name == "omitempty" || fn == nil {
+		panic("gee: invalid validation " + strconv.Quote(name))
+	}
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = fn
+}
+
+// FieldError is a field that failed one rule of its binding tag
+type FieldError struct {
+	Field string // the path of the struct field, e.g. "Items[0].Name"
+	Rule  string
+	Param string
+	Value interface{}
+}
+
+func (e *FieldError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("field %s failed on the '%s' rule", e.Field, e.Rule)
+	}
+	return fmt.Sprintf("field %s failed on the '%s=%s' rule", e.Field, e.Rule, e.Param)
+}
+
+// ValidationErrors is returned by the binding methods of Context when the
+// bound struct breaks the rules of its binding tags
+type ValidationErrors []*FieldError
+
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, e := range ve {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// MarshalJSON renders the errors as the body of a 400 response:
+// {"message": "validation failed", "errors": [{"field", "rule", "param", "message"}]}
+func (ve ValidationErrors) MarshalJSON() ([]byte, error) {
+	type fieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Param   string `json:"param,omitempty"`
+		Message string `json:"message"`
+	}
+	errs := make([]fieldError, len(ve))
+	for i, e := range ve {
+		errs[i] = fieldError{Field: e.Field, Rule: e.Rule, Param: e.Param, Message: e.Error()}
+	}
+	return json.Marshal(H{"message": "validation failed", "errors": errs})
+}
+
+// AbortWithBindError aborts with the response matching an error of the
+// binding methods: 400 with the ValidationErrors body for validation
+// errors, 415 for ErrUnsupportedContentType and 400 otherwise
+func (c *Context) AbortWithBindError(err error) {
+	var ve ValidationErrors
+	switch {
+	case c.Writer.Written():
+		// already answered, e.g. with 413 for a body too large
+		c.Abort()
+	case errors.As(err, &ve):
+		c.AbortWithStatusJSON(http.StatusBadRequest, ve)
+	case errors.Is(err, ErrUnsupportedContentType):
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, H{"message": err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, H{"message": err.Error()})
+	}
+}
+
+// validate checks obj against the binding tags of its fields, nested
+// structs and slices of structs are checked as well
+func validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	validateStruct(v, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, path string, errs *ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		fv := v.Field(i)
+		if tag := field.Tag.Get("binding"); tag != "" && tag != "-" {
+			validateField(fv, fieldPath, tag, errs)
+		}
+		validateNested(fv, fieldPath, errs)
+	}
+}
+
+func validateNested(fv reflect.Value, path string, errs *ValidationErrors) {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() != timeType {
+			validateStruct(fv, path, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			validateNested(fv.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func lookupValidator(name string) (ValidatorFunc, bool) {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	fn, ok := validators[name]
+	return fn, ok
+}
+
+func validateField(fv reflect.Value, path string, tag string, errs *ValidationErrors) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if isEmpty(fv) {
+				return
+			}
+			continue
+		case "required":
+			if isEmpty(fv) {
+				*errs = append(*errs, &FieldError{Field: path, Rule: name, Value: fieldValue(fv)})
+				return
+			}
+			continue
+		}
+
+		fn, ok := lookupValidator(name)
+		if !ok {
+			panic("gee: unknown validation " + strconv.Quote(name) + " on field " + path)
+		}
+		value := fv
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return
+			}
+			value = value.Elem()
+		}
+		if !fn(value, param) {
+			*errs = append(*errs, &FieldError{Field: path, Rule: name, Param: param, Value: fieldValue(fv)})
+			return
+		}
+	}
+}
+
+func isEmpty(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return fv.Len() == 0
+	default:
+		return fv.IsZero()
+	}
+}
+
+func fieldValue(fv reflect.Value) interface{} {
+	if fv.CanInterface() {
+		return fv.Interface()
+	}
+	return nil
+}
+
+// measure returns the value of numbers, the length in runes of strings
+// and the length of slices, arrays and maps
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true
+	}
+	return 0, false
+}
+
+func compareRule(cmp func(n, p float64) bool) ValidatorFunc {
+	return func(fv reflect.Value, param string) bool {
+		p, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic("gee: invalid validation parameter " + strconv.Quote(param))
+		}
+		n, ok := measure(fv)
+		return ok && cmp(n, p)
+	}
+}
+
+func validateOneOf(fv reflect.Value, param string) bool {
+	var s string
+	switch fv.Kind() {
+	case reflect.String:
+		s = fv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(fv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(fv.Uint(), 10)
+	default:
+		return false
+	}
+	for _, option := range strings.Fields(param) {
+		if s == option {
+			return true
+		}
+	}
+	return false
+}
+
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+func validateEmail(fv reflect.Value, _ string) bool {
+	return fv.Kind() == reflect.String && emailRegexp.MatchString(fv.String())
+}
+
+func validateURL(fv reflect.Value, _ string) bool {
+	if fv.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.ParseRequestURI(fv.String())
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,97 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type signupItem struct {
+	SKU string `json:"sku" binding:"required,len=6"`
+}
+
+type signupRequest struct {
+	Name    string       `json:"name" binding:"required,min=1,max=8"`
+	Email   string       `json:"email" binding:"required,email"`
+	Plan    string       `json:"plan" binding:"oneof=free pro"`
+	Age     *int         `json:"age" binding:"omitempty,gte=18"`
+	Website string       `json:"website" binding:"omitempty,url"`
+	Coupon  string       `json:"coupon" binding:"omitempty,even"`
+	Items   []signupItem `json:"items" binding:"required,max=2"`
+}
+
+func TestValidationRules(t *testing.T) {
+	RegisterValidation("even", func(fv reflect.Value, _ string) bool {
+		return len(fv.String())%2 == 0
+	})
+
+	tests := []struct {
+		body   string
+		fields []string
+	}{
+		{`{"name":"gee","email":"gee@example.com","plan":"pro","items":[{"sku":"ABCDEF"}]}`, nil},
+		{`{"name":"","email":"gee","plan":"gold","items":[]}`, []string{"Name", "Email", "Plan", "Items"}},
+		{`{"name":"geektutu-gee","email":"gee@example.com","plan":"free","age":17,"items":[{"sku":"A"}]}`, []string{"Name", "Age", "Items[0].SKU"}},
+		{`{"name":"gee","email":"gee@example.com","plan":"free","website":"example","coupon":"abc","items":[{"sku":"ABCDEF"},{"sku":"ABCDEF"},{"sku":"ABCDEF"}]}`, []string{"Website", "Coupon", "Items"}},
+	}
+	for _, tt := range tests {
+		c := newBindContext("POST", "/", MIMEJSON, tt.body)
+		var req signupRequest
+		err := c.Bind(&req)
+		if tt.fields == nil {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tt.body, err)
+			}
+			continue
+		}
+		var ve ValidationErrors
+		if !errors.As(err, &ve) {
+			t.Fatalf("%s: error should be ValidationErrors, got %v", tt.body, err)
+		}
+		fields := make([]string, len(ve))
+		for i, e := range ve {
+			fields[i] = e.Field
+		}
+		if strings.Join(fields, " ") != strings.Join(tt.fields, " ") {
+			t.Fatalf("%s: failed fields should be %v, got %v", tt.body, tt.fields, fields)
+		}
+	}
+}
+
+func TestValidationErrorsResponse(t *testing.T) {
+	r := New()
+	r.POST("/signup", func(c *Context) {
+		var req signupRequest
+		if err := c.Bind(&req); err != nil {
+			c.AbortWithBindError(err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	req := httptest.NewRequest("POST", "/signup", strings.NewReader(`{"email":"gee","plan":"free","items":[{"sku":"ABCDEF"}]}`))
+	req.Header.Set("Content-Type", MIMEJSON)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status should be 400, got %d", w.Code)
+	}
+	var body struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Message != "validation failed" || len(body.Errors) != 2 ||
+		body.Errors[0].Field != "Name" || body.Errors[0].Rule != "required" ||
+		body.Errors[1].Field != "Email" || body.Errors[1].Rule != "email" {
+		t.Fatalf("unexpected body %s", w.Body.String())
+	}
+}
@@ -0,0 +1,623 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The message types of RFC 6455 section 5.2
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// The close codes of RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// defaultWSMaxMessageSize is the default of WSConn.MaxMessageSize
+const defaultWSMaxMessageSize = 32 << 20 // 32 MB
+
+// wsGUID is appended to the key of a handshake, see RFC 6455 section 1.3
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrWSBadHandshake is returned by WSDial when the server refuses
+	// the upgrade
+	ErrWSBadHandshake = errors.New("gee: bad websocket handshake")
+	// ErrWSCloseSent is returned by the writes that follow a close frame
+	ErrWSCloseSent = errors.New("gee: websocket close frame already sent")
+)
+
+// CloseError is returned by WSConn.ReadMessage once the connection is
+// closed: by a close frame of the peer, or by a protocol error, in which
+// case the close frame was sent to the peer
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("gee: websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("gee: websocket closed with code %d: %s", e.Code, e.Text)
+}
+
+// IsCloseError reports whether err is a *CloseError with one of codes
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WSHandler serves an upgraded websocket connection, the connection is
+// closed when it returns
+type WSHandler func(c *Context, conn *WSConn)
+
+// WS defines a websocket route, the middleware of the group runs before
+// the upgrade and can refuse it by aborting with an error response
+func (group *RouterGroup) WS(pattern string, handler WSHandler) {
+	group.GET(pattern, func(c *Context) {
+		conn, err := c.upgradeWS()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(c, conn)
+	})
+}
+
+// upgradeWS answers the opening handshake, RFC 6455 section 4.2.
+// On failure the error response is already written.
+func (c *Context) upgradeWS() (*WSConn, error) {
+	fail := func(code int, msg string) (*WSConn, error) {
+		c.Fail(code, msg)
+		return nil, errors.New(msg)
+	}
+	if c.Method != http.MethodGet || !c.IsWebsocket() {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if c.GetHeader("Sec-WebSocket-Version") != "13" {
+		c.SetHeader("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := c.GetHeader("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := c.engine.WSCheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(c.Req) {
+		return fail(http.StatusForbidden, "websocket origin not allowed")
+	}
+
+	c.Status(http.StatusSwitchingProtocols)
+	netConn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, err.Error())
+	}
+	// the deadlines of the http.Server do not apply to the websocket
+	netConn.SetDeadline(time.Time{})
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		netConn.Close()
+		c.Errors = append(c.Errors, err)
+		return nil, err
+	}
+	return newWSConn(netConn, brw.Reader, true), nil
+}
+
+// sameOrigin accepts the requests without Origin, and those whose Origin
+// has the host of the request
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WSConn is a websocket connection. One goroutine may read while others
+// write, writes are serialized and control frames may be sent between
+// the fragments of a message.
+type WSConn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	server bool // frames are masked by the client only
+
+	// MaxMessageSize is the size limit of the messages read, the peer
+	// gets CloseMessageTooBig beyond it. 32 MB by default, 0 for none.
+	MaxMessageSize int64
+
+	readErr     error
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+
+	messageMu sync.Mutex // held while a message is written
+	writeMu   sync.Mutex // held while a frame is written
+	closeSent bool
+}
+
+func newWSConn(conn net.Conn, br *bufio.Reader, server bool) *WSConn {
+	c := &WSConn{conn: conn, br: br, server: server, MaxMessageSize: defaultWSMaxMessageSize}
+	c.SetPingHandler(nil)
+	return c
+}
+
+// SetPingHandler sets the handler of the pings received by ReadMessage,
+// nil restores the default handler, which replies with a pong
+func (c *WSConn) SetPingHandler(h func(data []byte) error) {
+	if h == nil {
+		h = func(data []byte) error {
+			if err := c.writeFrame(true, PongMessage, data); err != nil && err != ErrWSCloseSent {
+				return err
+			}
+			return nil
+		}
+	}
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the handler of the pongs received by ReadMessage,
+// they are ignored by default
+func (c *WSConn) SetPongHandler(h func(data []byte) error) {
+	c.pongHandler = h
+}
+
+// LocalAddr returns the local network address
+func (c *WSConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of the reads of the connection
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the writes of the connection
+func (c *WSConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage returns the next text or binary message, fragmented
+// messages are reassembled. Pings and pongs are handed to their handlers
+// on the way. Once it returned an error, it returns it forever.
+func (c *WSConn) ReadMessage() (messageType int, data []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, data, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return messageType, data, err
+}
+
+func (c *WSConn) readMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.pingHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if c.pongHandler != nil {
+				if err := c.pongHandler(payload); err != nil {
+					return 0, nil, err
+				}
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message inside a fragmented message")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		message = append(message, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+			}
+			if message == nil {
+				message = []byte{}
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame, read is the size of the message read so far
+func (c *WSConn) readFrame(read int64) (fin bool, opcode int, payload []byte, err error) {
+	var h [8]byte
+	if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+		return false, 0, nil, c.readFailed(err)
+	}
+	fin = h[0]&0x80 != 0
+	opcode = int(h[0] & 0x0f)
+	if h[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	masked := h[1]&0x80 != 0
+	if masked != c.server {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid frame masking")
+	}
+
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+			return false, 0, nil, c.readFailed(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, h[:8]); err != nil {
+			return false, 0, nil, c.readFailed(err)
+		}
+		n = binary.BigEndian.Uint64(h[:8])
+		if n>>63 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+	if opcode >= CloseMessage && (!fin || n > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if opcode < CloseMessage && c.MaxMessageSize > 0 && int64(n) > c.MaxMessageSize-read {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, c.readFailed(err)
+		}
+	}
+	// the buffer grows with the bytes actually received, not with the
+	// length the peer declares
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(n)); err != nil {
+		return false, 0, nil, c.readFailed(err)
+	}
+	payload = buf.Bytes()
+	if masked {
+		maskBytes(key, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// readFailed turns a connection lost without close frame into
+// CloseAbnormalClosure
+func (c *WSConn) readFailed(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	return err
+}
+
+// fail sends a close frame for a protocol error of the peer
+func (c *WSConn) fail(code int, text string) error {
+	c.WriteClose(code, text)
+	return &CloseError{Code: code, Text: text}
+}
+
+// handleClose answers a close frame with the same code, RFC 6455
+// section 5.5.1, unless the close frame was already sent
+func (c *WSConn) handleClose(payload []byte) error {
+	if len(payload) == 0 {
+		c.writeFrame(true, CloseMessage, nil)
+		return &CloseError{Code: CloseNoStatusReceived}
+	}
+	if len(payload) < 2 {
+		return c.fail(CloseProtocolError, "invalid close frame")
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	text := payload[2:]
+	if !validCloseCode(code) || !utf8.Valid(text) {
+		return c.fail(CloseProtocolError, "invalid close frame")
+	}
+	c.WriteClose(code, "")
+	return &CloseError{Code: code, Text: string(text)}
+}
+
+// validCloseCode reports whether code may be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= CloseNormalClosure && code <= CloseUnsupportedData:
+		return true
+	case code >= CloseInvalidFramePayloadData && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// WriteMessage sends data as a single frame, messageType is TextMessage
+// or BinaryMessage
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("gee: invalid websocket message type %d", messageType)
+	}
+	c.messageMu.Lock()
+	defer c.messageMu.Unlock()
+	return c.writeFrame(true, messageType, data)
+}
+
+// NextWriter returns a writer of a fragmented message, each Write sends
+// a fragment and Close ends the message. Other messages wait until the
+// writer is closed.
+func (c *WSConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, fmt.Errorf("gee: invalid websocket message type %d", messageType)
+	}
+	c.messageMu.Lock()
+	return &wsWriter{conn: c, opcode: messageType}, nil
+}
+
+type wsWriter struct {
+	conn   *WSConn
+	opcode int
+	closed bool
+}
+
+func (w *wsWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("gee: websocket writer already closed")
+	}
+	if err := w.conn.writeFrame(false, w.opcode, p); err != nil {
+		return 0, err
+	}
+	w.opcode = continuationFrame
+	return len(p), nil
+}
+
+func (w *wsWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.conn.messageMu.Unlock()
+	return w.conn.writeFrame(true, w.opcode, nil)
+}
+
+// Ping sends a ping, the pong is handed to the pong handler by ReadMessage
+func (c *WSConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("gee: websocket ping data too long")
+	}
+	return c.writeFrame(true, PingMessage, data)
+}
+
+// WriteClose starts the closing handshake with code and text, ReadMessage
+// returns a *CloseError once the peer answers
+func (c *WSConn) WriteClose(code int, text string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(text) > 123 {
+		// cut at a rune boundary, the peer rejects invalid UTF-8
+		cut := 123
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	return c.writeFrame(true, CloseMessage, append(payload, text...))
+}
+
+// Close sends a CloseNormalClosure frame, unless a close frame was
+// already sent, and closes the network connection
+func (c *WSConn) Close() error {
+	c.WriteClose(CloseNormalClosure, "")
+	return c.conn.Close()
+}
+
+func (c *WSConn) writeFrame(fin bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrWSCloseSent
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame = append(frame, first)
+	var maskBit byte
+	if !c.server {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(n))
+	}
+	if c.server {
+		frame = append(frame, payload...)
+	} else {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(key, frame[start:])
+	}
+
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// WSDial opens a websocket connection to rawURL, of scheme ws, wss, http
+// or https, with the extra request headers of header. resp is the
+// response of the handshake, it is also returned with ErrWSBadHandshake
+// when the server refuses the upgrade.
+func WSDial(ctx context.Context, rawURL string, header http.Header) (conn *WSConn, resp *http.Response, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	secure := false
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme, secure = "https", true
+	default:
+		return nil, nil, fmt.Errorf("gee: unsupported websocket scheme %q", u.Scheme)
+	}
+	hostport := u.Host
+	if u.Port() == "" {
+		if secure {
+			hostport = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			hostport = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", hostport)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			netConn.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	if secure {
+		tlsConn := tls.Client(netConn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, nil, err
+		}
+		netConn = tlsConn
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header.Clone(),
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(netConn); err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err = http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		!headerHasToken(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		// keep the body readable once the connection is closed
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return nil, resp, ErrWSBadHandshake
+	}
+	netConn.SetDeadline(time.Time{})
+	return newWSConn(netConn, br, false), resp, nil
+}
@@ -0,0 +1,221 @@
+package gee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newWSServer(t *testing.T) (*httptest.Server, chan int) {
+	statuses := make(chan int, 10)
+	r := New()
+	r.Use(func(c *Context) {
+		c.Next()
+		statuses <- c.Writer.Status()
+	})
+	api := r.Group("/api")
+	api.Use(func(c *Context) {
+		if c.Query("token") != "secret" {
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+		}
+	})
+	api.WS("/echo", func(c *Context, conn *WSConn) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == TextMessage && string(data) == "fragments" {
+				w, _ := conn.NextWriter(TextMessage)
+				w.Write([]byte("frag"))
+				w.Write([]byte("ments"))
+				w.Close()
+				continue
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, statuses
+}
+
+func dialWS(t *testing.T, url string) *WSConn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := WSDial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	srv, statuses := newWSServer(t)
+	conn := dialWS(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/api/echo?token=secret")
+
+	big := []byte(strings.Repeat("x", 70000))
+	tests := []struct {
+		messageType int
+		data        []byte
+	}{
+		{TextMessage, []byte("hello gee")},
+		{BinaryMessage, []byte{0, 1, 2, 255}},
+		{BinaryMessage, big},
+		{TextMessage, []byte{}},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(tt.messageType, tt.data); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil || messageType != tt.messageType || string(data) != string(tt.data) {
+			t.Fatalf("unexpected echo %d %d bytes, %v", messageType, len(data), err)
+		}
+	}
+
+	// fragmented messages are reassembled, in both directions
+	w, _ := conn.NextWriter(TextMessage)
+	w.Write([]byte("hello "))
+	if err := conn.Ping([]byte("between fragments")); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("fragments"))
+	w.Close()
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data []byte) error {
+		pong <- string(data)
+		return nil
+	})
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hello fragments" {
+		t.Fatalf("unexpected fragmented echo %q, %v", data, err)
+	}
+	if p := <-pong; p != "between fragments" {
+		t.Fatalf("unexpected pong %q", p)
+	}
+	conn.WriteMessage(TextMessage, []byte("fragments"))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "fragments" {
+		t.Fatalf("unexpected fragmented message %q, %v", data, err)
+	}
+
+	// the closing handshake echoes the code
+	if err := conn.WriteClose(4000, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !IsCloseError(err, 4000) {
+		t.Fatalf("expected the close code to be echoed, got %v", err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, ErrWSCloseSent) {
+		t.Fatalf("writes after close should fail, got %v", err)
+	}
+	if status := <-statuses; status != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status 101 to be tracked, got %d", status)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	srv, _ := newWSServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/echo?token=secret"
+	tests := []struct {
+		frame []byte
+		code  int
+	}{
+		{[]byte{0xc1, 0x80, 0, 0, 0, 0}, CloseProtocolError},                       // reserved bit
+		{[]byte{0x81, 0x00}, CloseProtocolError},                                   // unmasked
+		{[]byte{0x80, 0x80, 0, 0, 0, 0}, CloseProtocolError},                       // continuation first
+		{[]byte{0x89, 0xfe, 0, 200, 0, 0, 0, 0}, CloseProtocolError},               // long ping
+		{[]byte{0x81, 0x82, 0, 0, 0, 0, 0xff, 0xfe}, CloseInvalidFramePayloadData}, // invalid UTF-8
+		{[]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xed}, CloseProtocolError},           // close code 1005
+	}
+	for _, tt := range tests {
+		conn := dialWS(t, url)
+		conn.conn.Write(tt.frame)
+		if _, _, err := conn.ReadMessage(); !IsCloseError(err, tt.code) {
+			t.Fatalf("frame % x: expected close code %d, got %v", tt.frame, tt.code, err)
+		}
+	}
+
+	conn := dialWS(t, url)
+	conn.MaxMessageSize = 4
+	conn.WriteMessage(TextMessage, []byte("too long"))
+	if _, _, err := conn.ReadMessage(); !IsCloseError(err, CloseMessageTooBig) {
+		t.Fatalf("expected CloseMessageTooBig, got %v", err)
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv, _ := newWSServer(t)
+	ctx := context.Background()
+
+	// the middleware runs before the upgrade
+	_, resp, err := WSDial(ctx, srv.URL+"/api/echo", nil)
+	if !errors.Is(err, ErrWSBadHandshake) || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a refused upgrade, got %v", err)
+	}
+
+	header := http.Header{"Origin": []string{"http://evil.example.com"}}
+	if _, resp, err := WSDial(ctx, srv.URL+"/api/echo?token=secret", header); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a cross-origin upgrade to be refused, got %v", err)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/echo?token=secret")
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a plain GET to be refused, got %v", err)
+	}
+	resp.Body.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/api/echo?token=secret", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("expected 426 for an old version, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestWebSocketHugeFrameHeader(t *testing.T) {
+	readErr := make(chan error, 1)
+	r := New()
+	r.WS("/unlimited", func(c *Context, conn *WSConn) {
+		conn.MaxMessageSize = 0
+		_, _, err := conn.ReadMessage()
+		readErr <- err
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn := dialWS(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/unlimited")
+	// a binary frame claiming 2^40 bytes, followed by 3 bytes only
+	conn.conn.Write([]byte{0x82, 0xff, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3})
+	conn.conn.Close()
+	select {
+	case err := <-readErr:
+		if !IsCloseError(err, CloseAbnormalClosure) {
+			t.Fatalf("expected CloseAbnormalClosure, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read did not end")
+	}
+}
+
+func TestWebSocketCloseReasonTruncation(t *testing.T) {
+	srv, _ := newWSServer(t)
+	conn := dialWS(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/api/echo?token=secret")
+	// "é" spans the bytes 122 and 123 of the reason
+	if err := conn.WriteClose(4000, strings.Repeat("x", 122)+"é and more"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !IsCloseError(err, 4000) {
+		t.Fatalf("the truncated reason should be valid UTF-8, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package gee
+
+import (
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// marshalYAML encodes v as a block-style YAML document. Struct fields
+// use their yaml tag, "name,omitempty" and "-" included, or their
+// lowercased name. Map keys are sorted.
+func marshalYAML(v interface{}) ([]byte, error) {
+	lines, scalar, err := yamlLines(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if scalar != "" {
+		return []byte(scalar + "\n"), nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// yamlLines returns either the scalar form of v, or the lines of its
+// block form, not indented
+func yamlLines(v reflect.Value) (lines []string, scalar string, err error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, "null", nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, "null", nil
+	}
+
+	if v.Type() == timeType {
+		return nil, v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return nil, yamlString(string(text)), err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return nil, strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			return nil, yamlString(time.Duration(v.Int()).String()), nil
+		}
+		return nil, strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return nil, strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return nil, yamlFloat(v.Float(), v.Type().Bits()), nil
+	case reflect.String:
+		return nil, yamlString(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, "!!binary " + base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		return yamlSequence(v)
+	case reflect.Map:
+		return yamlMap(v)
+	case reflect.Struct:
+		return yamlStruct(v)
+	}
+	return nil, "", fmt.Errorf("gee: cannot encode %s as YAML", v.Type())
+}
+
+func yamlSequence(v reflect.Value) ([]string, string, error) {
+	if v.Len() == 0 {
+		return nil, "[]", nil
+	}
+	lines := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		child, scalar, err := yamlLines(v.Index(i))
+		if err != nil {
+			return nil, "", err
+		}
+		if scalar != "" {
+			lines = append(lines, "- "+scalar)
+			continue
+		}
+		for j, line := range child {
+			if j == 0 {
+				lines = append(lines, "- "+line)
+			} else {
+				lines = append(lines, "  "+line)
+			}
+		}
+	}
+	return lines, "", nil
+}
+
+// yamlEntry appends "key: value" in scalar or block form
+func yamlEntry(lines []string, key string, v reflect.Value) ([]string, error) {
+	child, scalar, err := yamlLines(v)
+	if err != nil {
+		return nil, err
+	}
+	if scalar != "" {
+		return append(lines, key+": "+scalar), nil
+	}
+	lines = append(lines, key+":")
+	for _, line := range child {
+		lines = append(lines, "  "+line)
+	}
+	return lines, nil
+}
+
+func yamlMap(v reflect.Value) ([]string, string, error) {
+	if v.Len() == 0 {
+		return nil, "{}", nil
+	}
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		_, key, err := yamlLines(iter.Key())
+		if err != nil || key == "" {
+			return nil, "", fmt.Errorf("gee: cannot encode map key of %s as YAML", v.Type())
+		}
+		entries = append(entries, entry{key, iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		var err error
+		if lines, err = yamlEntry(lines, e.key, e.value); err != nil {
+			return nil, "", err
+		}
+	}
+	return lines, "", nil
+}
+
+func yamlStruct(v reflect.Value) ([]string, string, error) {
+	t := v.Type()
+	lines := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fv := v.Field(i)
+		if opts == "omitempty" && isEmpty(fv) {
+			continue
+		}
+		var err error
+		if lines, err = yamlEntry(lines, yamlString(name), fv); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(lines) == 0 {
+		return nil, "{}", nil
+	}
+	return lines, "", nil
+}
+
+func yamlFloat(f float64, bits int) string {
+	switch {
+	case f != f:
+		return ".nan"
+	case f > 0 && f*2 == f:
+		return ".inf"
+	case f < 0 && f*2 == f:
+		return "-.inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// yamlString quotes s when it would otherwise be read as another type,
+// or does not fit a plain scalar. Every string starting like a number is
+// quoted: ints in any base, floats, sexagesimals and timestamps of YAML
+// 1.1 and 1.2 all start with a digit, a sign or a dot.
+func yamlString(s string) string {
+	if s == "" || strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s, "\n\r\t\"\\") || strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":") || strings.ContainsRune("-?:,[]{}#&*!|>'%@`+.0123456789", rune(s[0])) {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	switch strings.ToLower(s) {
+	case "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n", "<<", "=":
+		return strconv.Quote(s)
+	}
+	return s
+}